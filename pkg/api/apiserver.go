@@ -13,6 +13,10 @@ import (
 	"github.com/vshn/vshn-sli-reporting/pkg/api/downtime"
 	"github.com/vshn/vshn-sli-reporting/pkg/api/handler"
 	"github.com/vshn/vshn-sli-reporting/pkg/api/query"
+	apireport "github.com/vshn/vshn-sli-reporting/pkg/api/report"
+	"github.com/vshn/vshn-sli-reporting/pkg/api/status"
+	"github.com/vshn/vshn-sli-reporting/pkg/audit"
+	"github.com/vshn/vshn-sli-reporting/pkg/report"
 )
 
 type ApiServerConfig struct {
@@ -21,6 +25,11 @@ type ApiServerConfig struct {
 	Port     int
 	Host     string
 
+	// Query configures the metric and label names used to query Prometheus
+	Query query.Config
+	// ReportRenderer renders the reports, the built-in templates are used if nil
+	ReportRenderer *report.Renderer
+
 	Logger *logr.Logger
 }
 
@@ -31,22 +40,38 @@ type ApiServer struct {
 	server *http.Server
 }
 
-func NewApiServer(config ApiServerConfig, store downtime.DowntimeStore, prom query.PrometheusQuerier) ApiServer {
+// Lieutenant provides the cluster metadata
+type Lieutenant interface {
+	downtime.ClusterSource
+	query.ClusterLister
+	report.ClusterGetter
+}
+
+func NewApiServer(config ApiServerConfig, store downtime.DowntimeStore, prom query.PrometheusQuerier, lieutenant Lieutenant) (ApiServer, error) {
 	if config.Logger == nil {
 		l := logr.Discard()
 		config.Logger = &l
 	}
+	if config.ReportRenderer == nil {
+		r, err := report.NewRenderer("", "")
+		if err != nil {
+			return ApiServer{}, err
+		}
+		config.ReportRenderer = r
+	}
 	var mux = http.NewServeMux()
 	mux.Handle("/", handler.JSONFunc(func(r *http.Request) (any, error) {
 		return nil, handler.NewErrWithCode(errors.New("not found"), http.StatusNotFound)
 	}))
-	downtime.Setup(mux, store)
-	query.Setup(mux, store, prom)
+	downtime.Setup(mux, store, lieutenant)
+	query.Setup(mux, store, prom, lieutenant, config.Query)
+	apireport.Setup(mux, report.NewGenerator(query.NewQuerier(store, prom, lieutenant, config.Query), lieutenant), config.ReportRenderer)
+	status.Setup(mux, lieutenant)
 	return ApiServer{
 		config: config,
 		mux:    mux,
 		store:  store,
-	}
+	}, nil
 }
 
 func (s *ApiServer) Start() error {
@@ -70,12 +95,17 @@ func (s *ApiServer) Stop(ctx context.Context) error {
 
 func (s *ApiServer) logInject(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := audit.Actor{
+			RequestID:         r.Header.Get("X-Request-ID"),
+			InternalRequestID: uuid.NewString(),
+		}
 		logger := s.config.Logger.WithValues(
 			"method", r.Method, "url", r.URL.String(), "remote", r.RemoteAddr,
-			"request_id", r.Header.Get("X-Request-ID"), "internal_request_id", uuid.NewString(),
+			"request_id", actor.RequestID, "internal_request_id", actor.InternalRequestID,
 			"user_agent", r.UserAgent(),
 		)
 		ctx := logr.NewContext(r.Context(), logger)
+		ctx = audit.NewContext(ctx, actor)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -93,7 +123,9 @@ func (s *ApiServer) basicAuth(next http.Handler) http.HandlerFunc {
 			passwordMatch := (subtle.ConstantTimeCompare(passwordHash[:], expectedPasswordHash[:]) == 1)
 
 			if usernameMatch && passwordMatch {
-				next.ServeHTTP(w, r)
+				actor := audit.FromContext(r.Context())
+				actor.User = username
+				next.ServeHTTP(w, r.WithContext(audit.NewContext(r.Context(), actor)))
 				return
 			}
 		}
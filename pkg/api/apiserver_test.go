@@ -10,6 +10,7 @@ import (
 
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/vshn/vshn-sli-reporting/pkg/store/mock"
 	"github.com/vshn/vshn-sli-reporting/pkg/types"
 
@@ -23,17 +24,18 @@ var config = ApiServerConfig{
 	Host:     "localhost",
 }
 
-func setup(rv types.DowntimeWindow) (*ApiServer, *mock.MockDowntimeStore) {
+func setup(t *testing.T, rv types.DowntimeWindow) (*ApiServer, *mock.MockDowntimeStore) {
 	store := &mock.MockDowntimeStore{
 		ReturnValues: []types.DowntimeWindow{rv},
 	}
 
-	server := NewApiServer(config, store, noopPrometheus{})
+	server, err := NewApiServer(config, store, noopPrometheus{}, noopLieutenant{})
+	require.NoError(t, err)
 	return &server, store
 }
 
 func TestBasicAuthSucceeds(t *testing.T) {
-	serv, mock := setup(types.DowntimeWindow{Title: "Test1"})
+	serv, mock := setup(t, types.DowntimeWindow{Title: "Test1"})
 
 	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
 	time2, _ := time.Parse(time.RFC3339, "2020-02-02T00:00:00Z")
@@ -63,7 +65,7 @@ func TestBasicAuthSucceeds(t *testing.T) {
 }
 
 func TestBasicAuthFailsIfNotSet(t *testing.T) {
-	serv, _ := setup(types.DowntimeWindow{Title: "Test1"})
+	serv, _ := setup(t, types.DowntimeWindow{Title: "Test1"})
 
 	req := httptest.NewRequest(http.MethodGet, "/downtime?from=2020-01-01T00:00:00Z&to=2020-02-02T00:00:00Z", nil)
 	req.SetBasicAuth("admin", "pasfdasdfass")
@@ -80,7 +82,7 @@ func TestBasicAuthFailsIfNotSet(t *testing.T) {
 }
 
 func TestBasicAuthFailsIfInvalidCredentials(t *testing.T) {
-	serv, _ := setup(types.DowntimeWindow{Title: "Test1"})
+	serv, _ := setup(t, types.DowntimeWindow{Title: "Test1"})
 
 	req := httptest.NewRequest(http.MethodGet, "/downtime?from=2020-01-01T00:00:00Z&to=2020-02-02T00:00:00Z", nil)
 	w := httptest.NewRecorder()
@@ -104,3 +106,17 @@ func (m noopPrometheus) Query(ctx context.Context, query string, ts time.Time, o
 func (m noopPrometheus) QueryRange(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
 	return model.Matrix{}, nil, nil
 }
+
+type noopLieutenant struct{}
+
+func (m noopLieutenant) ListClusters(ctx context.Context, tenant string) ([]string, error) {
+	return nil, nil
+}
+
+func (m noopLieutenant) GetClusters(ctx context.Context) ([]types.Cluster, error) {
+	return nil, nil
+}
+
+func (m noopLieutenant) GetCluster(ctx context.Context, clusterID string) (types.Cluster, error) {
+	return types.Cluster{ID: clusterID}, nil
+}
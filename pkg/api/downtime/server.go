@@ -3,24 +3,54 @@ package downtime
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/vshn/vshn-sli-reporting/pkg/api/handler"
 	"github.com/vshn/vshn-sli-reporting/pkg/types"
 )
 
 type downtimeServer struct {
-	store DowntimeStore
+	store    DowntimeStore
+	clusters ClusterSource
 }
 
+// ClusterSource lists the metadata of all Lieutenant clusters
+type ClusterSource interface {
+	GetClusters(ctx context.Context) ([]types.Cluster, error)
+}
+
+// AffectedClusters are the clusters selected by the matchers of a downtime window
+type AffectedClusters struct {
+	Clusters []types.Cluster `json:"clusters"`
+	Warnings []string        `json:"warnings,omitempty"`
+}
+
+// CreateDowntimeResponse is the created downtime window with warnings about its matchers
+type CreateDowntimeResponse struct {
+	types.DowntimeWindow
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+const warningNoClusters = "the matchers of the downtime window do not select any cluster"
+
 type DowntimeStore interface {
-	StoreNewWindow(types.DowntimeWindow) (types.DowntimeWindow, error)
+	StoreNewWindow(context.Context, types.DowntimeWindow) (types.DowntimeWindow, error)
 	ListWindows(from time.Time, to time.Time) ([]types.DowntimeWindow, error)
+	ListWindowsIncludingDeleted(from time.Time, to time.Time) ([]types.DowntimeWindow, error)
+	ListWindowsAsOf(from time.Time, to time.Time, asOf time.Time) ([]types.DowntimeWindow, error)
 	ListWindowsMatchingClusterFacts(ctx context.Context, from time.Time, to time.Time, clusterId string) ([]types.DowntimeWindow, error)
-	UpdateWindow(types.DowntimeWindow) (types.DowntimeWindow, error)
-	PatchWindow(types.DowntimeWindow) (types.DowntimeWindow, error)
+	ListWindowsMatchingClusterFactsAsOf(ctx context.Context, from time.Time, to time.Time, clusterId string, asOf time.Time) ([]types.DowntimeWindow, error)
+	UpdateWindow(context.Context, types.DowntimeWindow) (types.DowntimeWindow, error)
+	PatchWindow(context.Context, types.DowntimeWindow) (types.DowntimeWindow, error)
+	GetWindow(id string) (types.DowntimeWindow, error)
+	GetWindowHistory(id string) ([]types.DowntimeRevision, error)
+	DeleteWindow(ctx context.Context, id string) (types.DowntimeWindow, error)
+	RestoreWindow(ctx context.Context, id string) (types.DowntimeWindow, error)
 }
 
 func (s *downtimeServer) ListDowntime(r *http.Request) (any, error) {
@@ -36,7 +66,33 @@ func (s *downtimeServer) ListDowntime(r *http.Request) (any, error) {
 		return nil, handler.NewErrWithCode(fmt.Errorf("could not parse `to` time: %w", err), http.StatusBadRequest)
 	}
 
-	ws, err := s.store.ListWindows(ft, tt)
+	includeDeleted := false
+	if v := r.URL.Query().Get("include_deleted"); v != "" {
+		includeDeleted, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, handler.NewErrWithCode(fmt.Errorf("could not parse `include_deleted`: %w", err), http.StatusBadRequest)
+		}
+	}
+
+	var asOf time.Time
+	if v := r.URL.Query().Get("as_of"); v != "" {
+		asOf, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, handler.NewErrWithCode(fmt.Errorf("could not parse `as_of` time: %w", err), http.StatusBadRequest)
+		}
+		if includeDeleted {
+			return nil, handler.NewErrWithCode(errors.New("`as_of` and `include_deleted` cannot be combined"), http.StatusBadRequest)
+		}
+	}
+
+	var ws []types.DowntimeWindow
+	if includeDeleted {
+		ws, err = s.store.ListWindowsIncludingDeleted(ft, tt)
+	} else if !asOf.IsZero() {
+		ws, err = s.store.ListWindowsAsOf(ft, tt, asOf)
+	} else {
+		ws, err = s.store.ListWindows(ft, tt)
+	}
 	if err != nil {
 		return nil, handler.NewErrWithCode(fmt.Errorf("could not list downtime windows: %w", err), http.StatusBadRequest)
 	}
@@ -68,6 +124,8 @@ func (s *downtimeServer) ListDowntimeForCluster(r *http.Request) (any, error) {
 	return ws, nil
 }
 
+// CreateDowntime stores a new window, or updates the window with the same external ID.
+// It responds with 409 Conflict if that window is deleted.
 func (s *downtimeServer) CreateDowntime(r *http.Request) (any, error) {
 	window := types.DowntimeWindow{}
 	err := json.NewDecoder(r.Body).Decode(&window)
@@ -75,13 +133,36 @@ func (s *downtimeServer) CreateDowntime(r *http.Request) (any, error) {
 		return nil, handler.NewErrWithCode(fmt.Errorf("invalid downtime window: %w", err), http.StatusBadRequest)
 	}
 
-	ws, err := s.store.StoreNewWindow(window)
+	ws, err := s.store.StoreNewWindow(r.Context(), window)
+
+	if err != nil {
+		return nil, handler.NewErrWithCode(fmt.Errorf("could not store downtime window: %w", err), errorCode(err))
+	}
+
+	res := CreateDowntimeResponse{DowntimeWindow: ws}
+	affected, err := s.affectedClusters(r.Context(), ws)
+	if err != nil {
+		// the window is stored, not being able to check its matchers must not fail the request
+		logr.FromContextOrDiscard(r.Context()).Error(err, "Could not check the clusters affected by the downtime window", "id", ws.ID)
+	} else {
+		res.Warnings = affected.Warnings
+	}
+
+	return handler.ResponseWithCode{Data: res, Code: http.StatusCreated}, nil
+}
 
+// PreviewDowntime returns the clusters the downtime window in the request body would affect, without storing it
+func (s *downtimeServer) PreviewDowntime(r *http.Request) (any, error) {
+	window := types.DowntimeWindow{}
+	err := json.NewDecoder(r.Body).Decode(&window)
 	if err != nil {
-		return nil, handler.NewErrWithCode(fmt.Errorf("could not store downtime window: %w", err), http.StatusBadRequest)
+		return nil, handler.NewErrWithCode(fmt.Errorf("invalid downtime window: %w", err), http.StatusBadRequest)
+	}
+	if err := types.ValidateAffects(window.Affects); err != nil {
+		return nil, handler.NewErrWithCode(fmt.Errorf("invalid downtime window: %w", err), http.StatusBadRequest)
 	}
 
-	return handler.ResponseWithCode{Data: ws, Code: http.StatusCreated}, nil
+	return s.affectedClusters(r.Context(), window)
 }
 
 func (s *downtimeServer) UpdateDowntime(r *http.Request) (any, error) {
@@ -92,9 +173,9 @@ func (s *downtimeServer) UpdateDowntime(r *http.Request) (any, error) {
 	}
 
 	window.ID = r.PathValue("id")
-	ws, err := s.store.UpdateWindow(window)
+	ws, err := s.store.UpdateWindow(r.Context(), window)
 	if err != nil {
-		return nil, handler.NewErrWithCode(fmt.Errorf("could not update downtime window: %w", err), http.StatusBadRequest)
+		return nil, handler.NewErrWithCode(fmt.Errorf("could not update downtime window: %w", err), errorCode(err))
 	}
 
 	return ws, nil
@@ -108,19 +189,112 @@ func (s *downtimeServer) PatchDowntime(r *http.Request) (any, error) {
 	}
 
 	window.ID = r.PathValue("id")
-	ws, err := s.store.PatchWindow(window)
+	ws, err := s.store.PatchWindow(r.Context(), window)
 	if err != nil {
-		return nil, handler.NewErrWithCode(fmt.Errorf("could not patch downtime window: %w", err), http.StatusBadRequest)
+		return nil, handler.NewErrWithCode(fmt.Errorf("could not patch downtime window: %w", err), errorCode(err))
 	}
 
 	return ws, nil
 }
 
-func Setup(mux *http.ServeMux, store DowntimeStore) {
-	s := downtimeServer{store}
+func (s *downtimeServer) GetDowntime(r *http.Request) (any, error) {
+	ws, err := s.store.GetWindow(r.PathValue("id"))
+	if err != nil {
+		return nil, handler.NewErrWithCode(fmt.Errorf("could not get downtime window: %w", err), errorCode(err))
+	}
+
+	return ws, nil
+}
+
+func (s *downtimeServer) DeleteDowntime(r *http.Request) (any, error) {
+	ws, err := s.store.DeleteWindow(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return nil, handler.NewErrWithCode(fmt.Errorf("could not delete downtime window: %w", err), errorCode(err))
+	}
+
+	return ws, nil
+}
+
+func (s *downtimeServer) RestoreDowntime(r *http.Request) (any, error) {
+	ws, err := s.store.RestoreWindow(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return nil, handler.NewErrWithCode(fmt.Errorf("could not restore downtime window: %w", err), errorCode(err))
+	}
+
+	return ws, nil
+}
+
+// GetDowntimeSubresource dispatches `GET /downtime/{id}/...` requests.
+// A single wildcard pattern is needed as fixed patterns like `/downtime/{id}/history` conflict with `/downtime/cluster/{clusterid}`.
+func (s *downtimeServer) GetDowntimeSubresource(r *http.Request) (any, error) {
+	switch r.PathValue("subresource") {
+	case "history":
+		return s.GetDowntimeHistory(r)
+	case "clusters":
+		return s.GetDowntimeClusters(r)
+	}
+	return nil, handler.NewErrWithCode(errors.New("not found"), http.StatusNotFound)
+}
+
+func (s *downtimeServer) GetDowntimeHistory(r *http.Request) (any, error) {
+	revs, err := s.store.GetWindowHistory(r.PathValue("id"))
+	if err != nil {
+		return nil, handler.NewErrWithCode(fmt.Errorf("could not get downtime window history: %w", err), errorCode(err))
+	}
+
+	return revs, nil
+}
+
+// GetDowntimeClusters returns the clusters affected by the downtime window
+func (s *downtimeServer) GetDowntimeClusters(r *http.Request) (any, error) {
+	ws, err := s.store.GetWindow(r.PathValue("id"))
+	if err != nil {
+		return nil, handler.NewErrWithCode(fmt.Errorf("could not get downtime window: %w", err), errorCode(err))
+	}
+
+	return s.affectedClusters(r.Context(), ws)
+}
+
+// affectedClusters returns the Lieutenant clusters whose match context matches any of the matchers of the window
+func (s *downtimeServer) affectedClusters(ctx context.Context, w types.DowntimeWindow) (AffectedClusters, error) {
+	clusters, err := s.clusters.GetClusters(ctx)
+	if err != nil {
+		return AffectedClusters{}, fmt.Errorf("could not list clusters: %w", err)
+	}
+
+	res := AffectedClusters{Clusters: []types.Cluster{}}
+	for _, c := range clusters {
+		if types.MatchesAny(w.Affects, c.MatchContext()) {
+			res.Clusters = append(res.Clusters, c)
+		}
+	}
+	if len(res.Clusters) == 0 {
+		res.Warnings = append(res.Warnings, warningNoClusters)
+	}
+	return res, nil
+}
+
+// errorCode returns the status code for store errors on a single window
+func errorCode(err error) int {
+	if errors.Is(err, types.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, types.ErrConflict) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+func Setup(mux *http.ServeMux, store DowntimeStore, clusters ClusterSource) {
+	s := downtimeServer{store: store, clusters: clusters}
 	mux.Handle("GET /downtime", handler.JSONFunc(s.ListDowntime))
 	mux.Handle("GET /downtime/cluster/{clusterid}", handler.JSONFunc(s.ListDowntimeForCluster))
 	mux.Handle("POST /downtime", handler.JSONFunc(s.CreateDowntime))
+	mux.Handle("POST /downtime/preview", handler.JSONFunc(s.PreviewDowntime))
 	mux.Handle("POST /downtime/{id}", handler.JSONFunc(s.UpdateDowntime))
 	mux.Handle("PATCH /downtime/{id}", handler.JSONFunc(s.PatchDowntime))
+	mux.Handle("GET /downtime/{id}", handler.JSONFunc(s.GetDowntime))
+	mux.Handle("DELETE /downtime/{id}", handler.JSONFunc(s.DeleteDowntime))
+	mux.Handle("POST /downtime/{id}/restore", handler.JSONFunc(s.RestoreDowntime))
+	mux.Handle("GET /downtime/{id}/{subresource}", handler.JSONFunc(s.GetDowntimeSubresource))
 }
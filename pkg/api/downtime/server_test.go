@@ -1,6 +1,7 @@
 package downtime
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -19,10 +20,22 @@ func setup(rv types.DowntimeWindow) (*http.ServeMux, *mock.MockDowntimeStore) {
 	}
 	mux := http.NewServeMux()
 
-	Setup(mux, store)
+	Setup(mux, store, testClusters)
 	return mux, store
 }
 
+type staticClusters []types.Cluster
+
+func (c staticClusters) GetClusters(ctx context.Context) ([]types.Cluster, error) {
+	return c, nil
+}
+
+var testClusters = staticClusters{
+	{ID: "c-one", DisplayName: "One", Tenant: "t-a", Facts: map[string]string{"distribution": "openshift4", "cloud": "cloudscale"}},
+	{ID: "c-two", DisplayName: "Two", Tenant: "t-a", Facts: map[string]string{"distribution": "k3s", "cloud": "cloudscale"}},
+	{ID: "c-three", DisplayName: "Three", Tenant: "t-b", Facts: map[string]string{"distribution": "openshift4", "cloud": "exoscale"}},
+}
+
 func setupError(rv types.DowntimeWindow) (*http.ServeMux, *mock.MockDowntimeStore) {
 	mux, store := setup(rv)
 	store.DoError = true
@@ -329,3 +342,302 @@ func TestCreateUpdatePatchDowntimeParseErrors(t *testing.T) {
 	assert.Equal(t, "400 Bad Request", res.Status)
 	assert.Equal(t, "", mock.LastCall)
 }
+
+func TestListDowntimeIncludingDeleted(t *testing.T) {
+	mux, mock := setup(types.DowntimeWindow{
+		Title: "Test1",
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/downtime?from=2020-01-01T00:00:00Z&to=2020-02-02T00:00:00Z&include_deleted=true", nil)
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "200 OK", res.Status)
+	assert.Equal(t, "listall", mock.LastCall)
+
+	req = httptest.NewRequest(http.MethodGet, "/downtime?from=2020-01-01T00:00:00Z&to=2020-02-02T00:00:00Z&include_deleted=maybe", nil)
+	w = httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res = w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "400 Bad Request", res.Status)
+}
+
+func TestGetDeleteRestoreDowntime(t *testing.T) {
+	mux, mock := setup(types.DowntimeWindow{
+		Title: "Test1",
+	})
+
+	for _, tc := range []struct {
+		method   string
+		path     string
+		lastCall string
+	}{
+		{http.MethodGet, "/downtime/asdf", "get"},
+		{http.MethodDelete, "/downtime/asdf", "delete"},
+		{http.MethodPost, "/downtime/asdf/restore", "restore"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		w := httptest.NewRecorder()
+
+		mux.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		assert.Equal(t, "200 OK", res.Status)
+		assert.Equal(t, tc.lastCall, mock.LastCall)
+		assert.Equal(t, "asdf", mock.LastCallID)
+
+		window := types.DowntimeWindow{}
+		err := json.NewDecoder(res.Body).Decode(&window)
+		assert.NoError(t, err)
+		assert.Equal(t, "Test1", window.Title)
+		assert.Equal(t, "asdf", window.ID)
+	}
+}
+
+func TestGetDeleteRestoreDowntimeErrors(t *testing.T) {
+	mux, mock := setup(types.DowntimeWindow{})
+	mock.ReturnValues = nil
+
+	for _, path := range []string{"/downtime/asdf", "/downtime/asdf/restore"} {
+		method := http.MethodGet
+		if strings.HasSuffix(path, "/restore") {
+			method = http.MethodPost
+		}
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+
+		mux.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		assert.Equal(t, "404 Not Found", res.Status)
+	}
+
+	mux, _ = setupError(types.DowntimeWindow{})
+	req := httptest.NewRequest(http.MethodDelete, "/downtime/asdf", nil)
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "400 Bad Request", res.Status)
+}
+
+func TestListDowntimeAsOf(t *testing.T) {
+	mux, mock := setup(types.DowntimeWindow{
+		Title: "Test1",
+	})
+
+	asOf, _ := time.Parse(time.RFC3339, "2020-03-01T00:00:00Z")
+	req := httptest.NewRequest(http.MethodGet, "/downtime?from=2020-01-01T00:00:00Z&to=2020-02-02T00:00:00Z&as_of=2020-03-01T00:00:00Z", nil)
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "200 OK", res.Status)
+	assert.Equal(t, "listasof", mock.LastCall)
+	assert.True(t, mock.LastCallAsOf.Equal(asOf))
+
+	for _, q := range []string{"as_of=bogus", "as_of=2020-03-01T00:00:00Z&include_deleted=true"} {
+		req = httptest.NewRequest(http.MethodGet, "/downtime?from=2020-01-01T00:00:00Z&to=2020-02-02T00:00:00Z&"+q, nil)
+		w = httptest.NewRecorder()
+
+		mux.ServeHTTP(w, req)
+
+		res = w.Result()
+		defer res.Body.Close()
+
+		assert.Equal(t, "400 Bad Request", res.Status)
+	}
+}
+
+func TestGetDowntimeHistory(t *testing.T) {
+	mux, mock := setup(types.DowntimeWindow{})
+	mock.Revisions = []types.DowntimeRevision{
+		{ID: 1, WindowID: "asdf", Action: "create", User: "admin", After: types.DowntimeWindow{ID: "asdf", Title: "Test1"}},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/downtime/asdf/history", nil)
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "200 OK", res.Status)
+	assert.Equal(t, "history", mock.LastCall)
+	assert.Equal(t, "asdf", mock.LastCallID)
+
+	revs := []types.DowntimeRevision{}
+	err := json.NewDecoder(res.Body).Decode(&revs)
+	assert.NoError(t, err)
+	assert.Equal(t, mock.Revisions, revs)
+
+	req = httptest.NewRequest(http.MethodGet, "/downtime/asdf/bogus", nil)
+	w = httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+	res = w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "404 Not Found", res.Status)
+}
+
+func TestGetDowntimeClusters(t *testing.T) {
+	mux, mock := setup(types.DowntimeWindow{
+		Affects: []types.AffectedClusterMatcher{
+			{"distribution": {Value: "openshift4"}, "cloud": {Value: "cloudscale"}},
+			{"distribution": {Op: types.MatchEqual, Value: "k3s"}},
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/downtime/asdf/clusters", nil)
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "200 OK", res.Status)
+	assert.Equal(t, "get", mock.LastCall)
+	assert.Equal(t, "asdf", mock.LastCallID)
+
+	affected := AffectedClusters{}
+	err := json.NewDecoder(res.Body).Decode(&affected)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Cluster{testClusters[0], testClusters[1]}, affected.Clusters)
+	assert.Empty(t, affected.Warnings)
+
+	mock.ReturnValues = nil
+	req = httptest.NewRequest(http.MethodGet, "/downtime/asdf/clusters", nil)
+	w = httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+	res = w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "404 Not Found", res.Status)
+}
+
+func TestPreviewDowntime(t *testing.T) {
+	mux, mock := setup(types.DowntimeWindow{})
+
+	for name, tc := range map[string]struct {
+		body             string
+		expectedStatus   string
+		expectedClusters []string
+		expectedWarnings []string
+	}{
+		"match": {
+			body:             `{"title": "Test1", "affects": [{"cloud": {"op": "=~", "value": "exo.*"}}]}`,
+			expectedStatus:   "200 OK",
+			expectedClusters: []string{"c-three"},
+		},
+		"match tenant and cluster ID": {
+			body:             `{"title": "Test1", "affects": [{"cluster:tenant": "t-a", "cluster:id": {"op": "!=", "value": "c-one"}}]}`,
+			expectedStatus:   "200 OK",
+			expectedClusters: []string{"c-two"},
+		},
+		"match all": {
+			body:             `{"title": "Test1", "affects": [{}]}`,
+			expectedStatus:   "200 OK",
+			expectedClusters: []string{"c-one", "c-two", "c-three"},
+		},
+		"no match": {
+			body:             `{"title": "Test1", "affects": [{"cloud": "azure"}]}`,
+			expectedStatus:   "200 OK",
+			expectedClusters: []string{},
+			expectedWarnings: []string{warningNoClusters},
+		},
+		"invalid matcher": {
+			body:           `{"title": "Test1", "affects": [{"cloud": {"op": "=~", "value": "("}}]}`,
+			expectedStatus: "400 Bad Request",
+		},
+		"invalid json": {
+			body:           `{"title": `,
+			expectedStatus: "400 Bad Request",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mock.LastCall = ""
+			req := httptest.NewRequest(http.MethodPost, "/downtime/preview", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+
+			mux.ServeHTTP(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.expectedStatus, res.Status)
+			assert.Empty(t, mock.LastCall, "preview must not store the window")
+			if tc.expectedClusters == nil {
+				return
+			}
+
+			affected := AffectedClusters{}
+			err := json.NewDecoder(res.Body).Decode(&affected)
+			assert.NoError(t, err)
+			ids := []string{}
+			for _, c := range affected.Clusters {
+				ids = append(ids, c.ID)
+			}
+			assert.Equal(t, tc.expectedClusters, ids)
+			assert.Equal(t, tc.expectedWarnings, affected.Warnings)
+		})
+	}
+}
+
+func TestCreateDowntimeWarnings(t *testing.T) {
+	mux, _ := setup(types.DowntimeWindow{})
+
+	for body, expectedWarnings := range map[string][]string{
+		`{"title": "Test1", "affects": [{"distribution": "openshift4"}]}`: nil,
+		`{"title": "Test1", "affects": [{"distribution": "talos"}]}`:      {warningNoClusters},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/downtime", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		mux.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+
+		assert.Equal(t, "201 Created", res.Status)
+		created := CreateDowntimeResponse{}
+		err := json.NewDecoder(res.Body).Decode(&created)
+		assert.NoError(t, err)
+		assert.Equal(t, "Test1", created.Title)
+		assert.Equal(t, expectedWarnings, created.Warnings)
+	}
+}
+
+func TestCreateDowntimeDeletedExternalID(t *testing.T) {
+	deleted := time.Now()
+	mux, mock := setup(types.DowntimeWindow{ExternalID: "a", DeletedAt: &deleted})
+
+	jsonstr, err := json.Marshal(types.DowntimeWindow{
+		Title:      "Test1",
+		ExternalID: "a",
+	})
+	assert.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/downtime", strings.NewReader(string(jsonstr)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, "409 Conflict", res.Status)
+	assert.Equal(t, "create", mock.LastCall)
+}
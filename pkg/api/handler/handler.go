@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -31,24 +35,124 @@ func (f JSONFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		l.Error(err, "Failed to process request", "status", statusCode)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-
+	code := http.StatusOK
 	if rwc, ok := result.(ResponseWithCode); ok {
-		statusCode = rwc.Code
-		w.WriteHeader(rwc.Code)
+		code = rwc.Code
 		result = rwc.Data
 	} else if rwc, ok := result.(*ResponseWithCode); ok {
-		statusCode = rwc.Code
-		w.WriteHeader(rwc.Code)
+		code = rwc.Code
 		result = rwc.Data
 	}
 
+	if raw, ok := result.(RawResponse); ok {
+		w.Header().Set("Content-Type", raw.ContentType)
+		statusCode = code
+		w.WriteHeader(code)
+		if _, err := w.Write(raw.Body); err != nil {
+			l.Error(err, "Failed to write response")
+		}
+		return
+	}
+
+	csvResult, supportsCSV := result.(CSVMarshaler)
+	contentType, err := negotiateContentType(r, supportsCSV)
+	if err != nil {
+		statusCode = http.StatusNotAcceptable
+		cr := ErrWithCode{}
+		if errors.As(err, &cr) {
+			statusCode = cr.Code
+		}
+		http.Error(w, err.Error(), statusCode)
+		l.Error(err, "Failed to negotiate content type", "status", statusCode)
+		return
+	}
+
+	if contentType == ContentTypeCSV {
+		records, err := csvResult.MarshalCSV()
+		if err != nil {
+			statusCode = http.StatusInternalServerError
+			http.Error(w, err.Error(), statusCode)
+			l.Error(err, "Failed to marshal CSV", "status", statusCode)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeCSV+"; charset=utf-8")
+		statusCode = code
+		w.WriteHeader(code)
+		// We can't return any error as the response might be already partially written
+		if err := csv.NewWriter(w).WriteAll(records); err != nil {
+			l.Error(err, "Failed to write response")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	statusCode = code
+	w.WriteHeader(code)
 	// We can't return any error as the response might be already partially written
 	if err := json.NewEncoder(w).Encode(result); err != nil {
 		l.Error(err, "Failed to write response")
 	}
 }
 
+// RawResponse is written as is with its content type, without content negotiation
+type RawResponse struct {
+	ContentType string
+	Body        []byte
+}
+
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeCSV  = "text/csv"
+)
+
+// CSVMarshaler is implemented by results that can be returned as CSV
+type CSVMarshaler interface {
+	// MarshalCSV returns the CSV records, starting with the header
+	MarshalCSV() ([][]string, error)
+}
+
+// negotiateContentType returns the content type of the response.
+// The `format` query parameter takes precedence over the Accept header.
+// CSV is only returned for results implementing CSVMarshaler, JSON is the default.
+func negotiateContentType(r *http.Request, supportsCSV bool) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+	case "json":
+		return ContentTypeJSON, nil
+	case "csv":
+		if !supportsCSV {
+			return "", errors.New("CSV is not supported for this resource")
+		}
+		return ContentTypeCSV, nil
+	default:
+		return "", NewErrWithCode(fmt.Errorf("unsupported `format` %q, expected \"json\" or \"csv\"", format), http.StatusBadRequest)
+	}
+
+	contentType, quality := ContentTypeJSON, 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= quality {
+			continue
+		}
+		switch {
+		case mediaType == ContentTypeCSV && supportsCSV:
+			contentType, quality = ContentTypeCSV, q
+		case mediaType == ContentTypeJSON || mediaType == "application/*" || mediaType == "*/*":
+			contentType, quality = ContentTypeJSON, q
+		}
+	}
+	return contentType, nil
+}
+
 type ErrWithCode struct {
 	Err  error
 	Code int
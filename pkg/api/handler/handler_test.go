@@ -84,3 +84,116 @@ func TestJSONFunc(t *testing.T) {
 		})
 	}
 }
+
+type csvResult struct {
+	Value string `json:"value"`
+}
+
+func (c csvResult) MarshalCSV() ([][]string, error) {
+	return [][]string{{"value"}, {c.Value}}, nil
+}
+
+func TestJSONFuncContentNegotiation(t *testing.T) {
+	tests := []struct {
+		name          string
+		handlerResult any
+		query         string
+		accept        string
+
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "json by default",
+			handlerResult:   csvResult{Value: "a"},
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        "{\"value\":\"a\"}\n",
+		},
+		{
+			name:            "csv by format",
+			handlerResult:   csvResult{Value: "a"},
+			query:           "?format=csv",
+			accept:          "application/json",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "value\na\n",
+		},
+		{
+			name:            "csv by accept header",
+			handlerResult:   csvResult{Value: "a"},
+			accept:          "text/csv",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "value\na\n",
+		},
+		{
+			name:            "preferred by quality",
+			handlerResult:   csvResult{Value: "a"},
+			accept:          "text/csv;q=0.5, application/json",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        "{\"value\":\"a\"}\n",
+		},
+		{
+			name:            "csv with code",
+			handlerResult:   ResponseWithCode{Data: csvResult{Value: "a"}, Code: http.StatusCreated},
+			accept:          "text/csv, application/json",
+			wantStatus:      http.StatusCreated,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "value\na\n",
+		},
+		{
+			name:            "json if csv is not supported",
+			handlerResult:   "test",
+			accept:          "text/csv",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        "\"test\"\n",
+		},
+		{
+			name:          "csv format not supported",
+			handlerResult: "test",
+			query:         "?format=csv",
+			wantStatus:    http.StatusNotAcceptable,
+			wantBody:      "CSV is not supported",
+		},
+		{
+			name:            "raw response",
+			handlerResult:   RawResponse{ContentType: "text/html", Body: []byte("<p>a</p>")},
+			query:           "?format=html",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/html",
+			wantBody:        "<p>a</p>",
+		},
+		{
+			name:          "unknown format",
+			handlerResult: csvResult{Value: "a"},
+			query:         "?format=xml",
+			wantStatus:    http.StatusBadRequest,
+			wantBody:      "unsupported `format`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			JSONFunc(func(r *http.Request) (any, error) {
+				return tt.handlerResult, nil
+			}).ServeHTTP(rr, req)
+			res := rr.Result()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantContentType != "" {
+				assert.Equal(t, tt.wantContentType, res.Header.Get("Content-Type"))
+			}
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), tt.wantBody)
+		})
+	}
+}
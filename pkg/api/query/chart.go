@@ -0,0 +1,148 @@
+package query
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	chartWidth        = 800
+	chartHeight       = 320
+	chartMarginLeft   = 70
+	chartMarginRight  = 20
+	chartMarginTop    = 40
+	chartMarginBottom = 50
+
+	chartColorAdjusted = "#1f77b4"
+	chartColorReal     = "#ff7f0e"
+	chartColorBudget   = "#d62728"
+	chartColorDowntime = "#7f7f7f"
+)
+
+// RenderBurnDownChart writes an SVG chart of the cumulative error rates of the SLO against its error budget.
+// Steps with downtime are shaded according to their excluded fraction.
+func RenderBurnDownChart(w io.Writer, res QueryClusterResponse, slothID string) error {
+	d, ok := res.SLIData[slothID]
+	if !ok {
+		return fmt.Errorf("no SLI data for SLO %q", slothID)
+	}
+
+	plotW := float64(chartWidth - chartMarginLeft - chartMarginRight)
+	plotH := float64(chartHeight - chartMarginTop - chartMarginBottom)
+	span := res.To.Sub(res.From)
+	if span <= 0 {
+		return fmt.Errorf("invalid time window %s - %s", res.From, res.To)
+	}
+
+	maxY := 0.0
+	for _, dp := range d.DataPoints {
+		maxY = max(maxY, dp.CumulativeAverageErrorRate, dp.CumulativeAverageRealErrorRate, 1-dp.Objective)
+	}
+	if maxY <= 0 {
+		maxY = 1 - d.Objective
+	}
+	if maxY <= 0 {
+		maxY = 0.01
+	}
+	maxY *= 1.1
+
+	x := func(t time.Time) float64 {
+		return chartMarginLeft + float64(t.Sub(res.From))/float64(span)*plotW
+	}
+	y := func(v float64) float64 {
+		return chartMarginTop + plotH - v/maxY*plotH
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n", chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<title>%s</title>`+"\n", html.EscapeString(fmt.Sprintf("Error budget burn-down of %s on %s", slothID, res.ClusterID)))
+	fmt.Fprintf(&b, `<rect x="0" y="0" width="%d" height="%d" fill="white"/>`+"\n", chartWidth, chartHeight)
+
+	// downtimes
+	prev := res.From
+	for _, dp := range d.DataPoints {
+		if dp.ExcludedFraction > 0 {
+			fmt.Fprintf(&b, `<rect x="%s" y="%d" width="%s" height="%s" fill="%s" fill-opacity="%s"/>`+"\n",
+				coord(x(prev)), chartMarginTop, coord(x(dp.Timestamp)-x(prev)), coord(plotH), chartColorDowntime, coord(0.35*dp.ExcludedFraction))
+		}
+		prev = dp.Timestamp
+	}
+
+	// axes and grid
+	for i := 0; i <= 4; i++ {
+		v := maxY * float64(i) / 4
+		fmt.Fprintf(&b, `<line x1="%d" y1="%s" x2="%d" y2="%s" stroke="#e0e0e0"/>`+"\n", chartMarginLeft, coord(y(v)), chartWidth-chartMarginRight, coord(y(v)))
+		fmt.Fprintf(&b, `<text x="%d" y="%s" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n", chartMarginLeft-6, coord(y(v)), FormatPercent(v))
+	}
+	fmt.Fprintf(&b, `<line x1="%d" y1="%s" x2="%d" y2="%s" stroke="black"/>`+"\n", chartMarginLeft, coord(y(0)), chartWidth-chartMarginRight, coord(y(0)))
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%s" stroke="black"/>`+"\n", chartMarginLeft, chartMarginTop, chartMarginLeft, coord(y(0)))
+	for i := 0; i <= 4; i++ {
+		t := res.From.Add(span * time.Duration(i) / 4)
+		fmt.Fprintf(&b, `<text x="%s" y="%d" text-anchor="middle">%s</text>`+"\n", coord(x(t)), chartHeight-chartMarginBottom+18, t.Format("2006-01-02 15:04"))
+	}
+
+	// error budget, following objective changes
+	if len(d.DataPoints) > 0 {
+		points := []string{}
+		prev = res.From
+		for _, dp := range d.DataPoints {
+			points = append(points, point(x(prev), y(1-dp.Objective)), point(x(dp.Timestamp), y(1-dp.Objective)))
+			prev = dp.Timestamp
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5" stroke-dasharray="6 4"/>`+"\n", strings.Join(points, " "), chartColorBudget)
+	}
+
+	// cumulative error rates
+	for _, series := range []struct {
+		color string
+		value func(SLIDataPoint) float64
+	}{
+		{chartColorReal, func(dp SLIDataPoint) float64 { return dp.CumulativeAverageRealErrorRate }},
+		{chartColorAdjusted, func(dp SLIDataPoint) float64 { return dp.CumulativeAverageErrorRate }},
+	} {
+		points := []string{point(x(res.From), y(0))}
+		for _, dp := range d.DataPoints {
+			points = append(points, point(x(dp.Timestamp), y(series.value(dp))))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`+"\n", strings.Join(points, " "), series.color)
+	}
+
+	// legend
+	for i, entry := range []struct{ color, label string }{
+		{chartColorAdjusted, "Adjusted error rate"},
+		{chartColorReal, "Real error rate"},
+		{chartColorBudget, "Error budget"},
+		{chartColorDowntime, "Downtime"},
+	} {
+		lx := chartMarginLeft + i*170
+		fmt.Fprintf(&b, `<rect x="%d" y="12" width="14" height="10" fill="%s"/>`+"\n", lx, entry.color)
+		fmt.Fprintf(&b, `<text x="%d" y="21">%s</text>`+"\n", lx+20, entry.label)
+	}
+
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func coord(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
+
+func point(x, y float64) string {
+	return coord(x) + "," + coord(y)
+}
+
+// FormatPercent formats a ratio as a percentage with up to three decimals, e.g. 0.9995 as "99.95%"
+func FormatPercent(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100_000)/1000, 'f', -1, 64) + "%"
+}
+
+// FormatHours formats a number of hours with up to two decimals, e.g. 0.25 as "0.25h"
+func FormatHours(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64) + "h"
+}
@@ -0,0 +1,102 @@
+package query
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+func TestQueryClusterChart(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	mux, _ := setup(
+		[]types.DowntimeWindow{
+			{
+				Title:     "Test1",
+				StartTime: ptrTo(from.Add(time.Hour)),
+				EndTime:   ptrTo(from.Add(90 * time.Minute)),
+			},
+		},
+		staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{Metric: model.Metric{"sloth_id": "full"}, Value: 0.9},
+		}},
+		staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, sloErrorMetric("full"), from, "0 0.2 0 0.1"),
+		)},
+	)
+
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		req := httptest.
+			NewRequest(http.MethodGet, fmt.Sprintf("%s?from=%s&to=%s", path, from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+			WithContext(logr.NewContext(t.Context(), testr.New(t)))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(t, "/query/cluster/blub/chart/full.svg")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	svg := w.Body.String()
+	assertWellFormedXML(t, svg)
+	// the downtime covers half of the second step
+	assert.Contains(t, svg, `<rect x="247.5" y="40" width="177.5" height="230" fill="#7f7f7f" fill-opacity="0.18"/>`)
+	assert.Equal(t, 3, strings.Count(svg, "<polyline"))
+
+	assert.Equal(t, http.StatusNotFound, get(t, "/query/cluster/blub/chart/full").Code)
+	assert.Equal(t, http.StatusNotFound, get(t, "/query/cluster/blub/chart/other.svg").Code)
+}
+
+func TestRenderBurnDownChart(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	res := QueryClusterResponse{
+		ClusterID: "c-<cluster>",
+		From:      from,
+		To:        from.Add(2 * time.Hour),
+		SLIData: map[string]QueryClusterResponseSLIData{
+			"full": {Objective: 0.99, DataPoints: []SLIDataPoint{
+				{Timestamp: from.Add(time.Hour), Objective: 0.99, CumulativeAverageErrorRate: 0.005, CumulativeAverageRealErrorRate: 0.005},
+				{Timestamp: from.Add(2 * time.Hour), Objective: 0.98, CumulativeAverageErrorRate: 0.01, CumulativeAverageRealErrorRate: 0.02},
+			}},
+		},
+	}
+
+	var b strings.Builder
+	require.NoError(t, RenderBurnDownChart(&b, res, "full"))
+	svg := b.String()
+	assertWellFormedXML(t, svg)
+	assert.Contains(t, svg, "<title>Error budget burn-down of full on c-&lt;cluster&gt;</title>")
+	// the error budget follows the objective change, the maximum is 2% + 10%
+	assert.Contains(t, svg, `<polyline points="70,165.45 425,165.45 425,60.91 780,60.91" fill="none" stroke="#d62728"`)
+	assert.Contains(t, svg, `<polyline points="70,270 425,217.73 780,165.45" fill="none" stroke="#1f77b4"`)
+	assert.Contains(t, svg, ">2.2%</text>")
+
+	assert.Error(t, RenderBurnDownChart(&b, res, "other"))
+}
+
+func assertWellFormedXML(t *testing.T, s string) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(s))
+	for {
+		_, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		require.NoError(t, err)
+	}
+}
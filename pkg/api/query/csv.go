@@ -0,0 +1,87 @@
+package query
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// QueryClusterSummary is a QueryClusterResponse rendered as a summary table with one row per SLO if returned as CSV.
+// The JSON representation is the same as QueryClusterResponse.
+type QueryClusterSummary QueryClusterResponse
+
+// MarshalCSV returns one row per SLO and data point
+func (r QueryClusterResponse) MarshalCSV() ([][]string, error) {
+	records := [][]string{{
+		"cluster_id",
+		"sloth_id",
+		"timestamp",
+		"error_rate",
+		"real_error_rate",
+		"cumulative_average_error_rate",
+		"cumulative_average_real_error_rate",
+		"excluded_fraction",
+		"objective",
+		"error_budget_remaining",
+		"missing",
+		"total_events",
+	}}
+	for _, name := range slices.Sorted(maps.Keys(r.SLIData)) {
+		for _, dp := range r.SLIData[name].DataPoints {
+			records = append(records, []string{
+				r.ClusterID,
+				name,
+				dp.Timestamp.Format(time.RFC3339),
+				formatFloat(dp.ErrorRate1h),
+				formatFloat(dp.RealErrorRate1h),
+				formatFloat(dp.CumulativeAverageErrorRate),
+				formatFloat(dp.CumulativeAverageRealErrorRate),
+				formatFloat(dp.ExcludedFraction),
+				formatFloat(dp.Objective),
+				formatFloat(dp.ErrorBudgetRemaining),
+				strconv.FormatBool(dp.Missing),
+				formatFloat(dp.TotalEvents),
+			})
+		}
+	}
+	return records, nil
+}
+
+// MarshalCSV returns one row per SLO with the values over the entire window
+func (r QueryClusterSummary) MarshalCSV() ([][]string, error) {
+	records := [][]string{{
+		"cluster_id",
+		"sloth_id",
+		"from",
+		"to",
+		"objective",
+		"error_rate_window",
+		"error_budget_remaining_window",
+		"error_budget_remaining_window_percent",
+		"missing_hours",
+		"total_events",
+		"error_events",
+	}}
+	for _, name := range slices.Sorted(maps.Keys(r.SLIData)) {
+		d := r.SLIData[name]
+		records = append(records, []string{
+			r.ClusterID,
+			name,
+			r.From.Format(time.RFC3339),
+			r.To.Format(time.RFC3339),
+			formatFloat(d.Objective),
+			formatFloat(d.ErrorRateWindow),
+			formatFloat(d.ErrorBudgetRemainingWindow),
+			formatFloat(d.ErrorBudgetRemainingWindowPercentage),
+			formatFloat(d.MissingHours),
+			formatFloat(d.TotalEvents),
+			formatFloat(d.ErrorEvents),
+		})
+	}
+	return records, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,86 @@
+package query
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+func TestQueryClusterCSV(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T02:00:00Z")
+
+	mux, _ := setup(
+		[]types.DowntimeWindow{
+			{
+				Title:     "Test1",
+				StartTime: ptrTo(from),
+				EndTime:   ptrTo(from.Add(30 * time.Minute)),
+			},
+		},
+		staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{Metric: model.Metric{"sloth_id": "b"}, Value: 0.75},
+			&model.Sample{Metric: model.Metric{"sloth_id": "a"}, Value: 0.75},
+		}},
+		staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, sloErrorMetric("b"), from, "0.5 0"),
+			promSampleStream(t, sloErrorMetric("a"), from, "0 0.25"),
+		)},
+	)
+
+	query := func(t *testing.T, query, accept string) [][]string {
+		req := httptest.
+			NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s%s", from.Format(time.RFC3339), to.Format(time.RFC3339), query), nil).
+			WithContext(logr.NewContext(t.Context(), testr.New(t)))
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		res := w.Result()
+		defer res.Body.Close()
+		require.Equal(t, "200 OK", res.Status)
+		require.Equal(t, "text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+		records, err := csv.NewReader(res.Body).ReadAll()
+		require.NoError(t, err)
+		return records
+	}
+
+	t.Run("data points", func(t *testing.T) {
+		records := query(t, "", "text/csv")
+		require.Equal(t, 5, len(records))
+		assert.Equal(t, []string{"cluster_id", "sloth_id", "timestamp", "error_rate", "real_error_rate", "cumulative_average_error_rate", "cumulative_average_real_error_rate", "excluded_fraction", "objective", "error_budget_remaining", "missing", "total_events"}, records[0])
+		assert.Equal(t, []string{"blub", "a", "2020-01-01T01:00:00Z", "0", "0", "0", "0", "0.5", "0.75", "0.25", "false", "0"}, records[1])
+		assert.Equal(t, []string{"blub", "a", "2020-01-01T02:00:00Z", "0.25", "0.25", "0.125", "0.125", "0", "0.75", "0", "false", "0"}, records[2])
+		assert.Equal(t, []string{"blub", "b", "2020-01-01T01:00:00Z", "0.25", "0.5", "0.125", "0.25", "0.5", "0.75", "0", "false", "0"}, records[3])
+	})
+
+	t.Run("summary", func(t *testing.T) {
+		records := query(t, "&view=summary&format=csv", "application/json")
+		require.Equal(t, 3, len(records))
+		assert.Equal(t, []string{"cluster_id", "sloth_id", "from", "to", "objective", "error_rate_window", "error_budget_remaining_window", "error_budget_remaining_window_percent", "missing_hours", "total_events", "error_events"}, records[0])
+		assert.Equal(t, "a", records[1][1])
+		assert.Equal(t, "2020-01-01T00:00:00Z", records[1][2])
+		assert.Equal(t, "2020-01-01T02:00:00Z", records[1][3])
+		assert.Equal(t, "0.125", records[1][5])
+		assert.Equal(t, "b", records[2][1])
+		assert.Equal(t, "0.125", records[2][5])
+	})
+
+	t.Run("invalid view", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/query/cluster/blub?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z&view=pie", nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
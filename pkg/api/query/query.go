@@ -1,17 +1,29 @@
 package query
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"math"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	promqlbuilder "github.com/perses/promql-builder"
 	"github.com/perses/promql-builder/label"
+	"github.com/perses/promql-builder/matrix"
 	"github.com/perses/promql-builder/vector"
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
 
 	"github.com/vshn/vshn-sli-reporting/pkg/api/handler"
 	"github.com/vshn/vshn-sli-reporting/pkg/types"
@@ -19,9 +31,114 @@ import (
 
 const SLOTH_ID_LABEL = "sloth_id"
 
+// Config contains the metric and label names used to query Prometheus.
+// Empty fields fall back to the names used by Sloth.
+type Config struct {
+	// ErrorRatioMetricPrefix is the name of the SLI error ratio recording rules without the step, e.g. "slo:sli_error:ratio_rate".
+	ErrorRatioMetricPrefix string
+	// ObjectiveMetric is the name of the SLO objective recording rule, e.g. "slo:objective:ratio".
+	ObjectiveMetric string
+	// EventsMetric is the name of a counter of all events of an SLO, labeled with the cluster and sloth ID labels.
+	// It is only used with the requests weighting. Sloth does not record such a counter, it has to be recorded from
+	// the same events as the SLI, e.g. "slo:sli_events:total". SLOs without events series are weighted by hours.
+	EventsMetric string
+	// ClusterLabel is the label identifying the cluster of a series, e.g. "cluster_id".
+	ClusterLabel string
+	// SlothIDLabel, SlothServiceLabel and SlothSLOLabel are the labels identifying the SLO of a series.
+	SlothIDLabel      string
+	SlothServiceLabel string
+	SlothSLOLabel     string
+}
+
+// DefaultConfig returns the metric and label names used by Sloth
+func DefaultConfig() Config {
+	return Config{
+		ErrorRatioMetricPrefix: "slo:sli_error:ratio_rate",
+		ObjectiveMetric:        "slo:objective:ratio",
+		EventsMetric:           "slo:sli_events:total",
+		ClusterLabel:           "cluster_id",
+		SlothIDLabel:           SLOTH_ID_LABEL,
+		SlothServiceLabel:      "sloth_service",
+		SlothSLOLabel:          "sloth_slo",
+	}
+}
+
+func (c Config) withDefaults() Config {
+	d := DefaultConfig()
+	if c.ErrorRatioMetricPrefix == "" {
+		c.ErrorRatioMetricPrefix = d.ErrorRatioMetricPrefix
+	}
+	if c.ObjectiveMetric == "" {
+		c.ObjectiveMetric = d.ObjectiveMetric
+	}
+	if c.EventsMetric == "" {
+		c.EventsMetric = d.EventsMetric
+	}
+	if c.ClusterLabel == "" {
+		c.ClusterLabel = d.ClusterLabel
+	}
+	if c.SlothIDLabel == "" {
+		c.SlothIDLabel = d.SlothIDLabel
+	}
+	if c.SlothServiceLabel == "" {
+		c.SlothServiceLabel = d.SlothServiceLabel
+	}
+	if c.SlothSLOLabel == "" {
+		c.SlothSLOLabel = d.SlothSLOLabel
+	}
+	return c
+}
+
+// steps maps the supported `step` parameter values to their duration.
+// Each step has a matching Sloth recording rule, e.g. `slo:sli_error:ratio_rate<step>`.
+var steps = map[string]time.Duration{
+	"5m":  5 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"2h":  2 * time.Hour,
+	"6h":  6 * time.Hour,
+	"1d":  24 * time.Hour,
+	"3d":  72 * time.Hour,
+}
+
+const defaultStep = "1h"
+
+const (
+	weightingHours    = "hours"
+	weightingRequests = "requests"
+)
+
+// missingDataPolicy defines how steps without an SLI sample or with a NaN sample are counted
+type missingDataPolicy string
+
+const (
+	// missingDataGood counts missing steps as without errors
+	missingDataGood missingDataPolicy = "good"
+	// missingDataBad counts missing steps as failed completely
+	missingDataBad missingDataPolicy = "bad"
+	// missingDataExclude drops missing steps from the window
+	missingDataExclude missingDataPolicy = "exclude"
+)
+
+var missingDataPolicies = []missingDataPolicy{missingDataGood, missingDataBad, missingDataExclude}
+
+// errorRate returns the error rate assumed for missing steps
+func (p missingDataPolicy) errorRate() float64 {
+	if p == missingDataBad {
+		return 1
+	}
+	return 0
+}
+
 type DowntimeLister interface {
 	ListWindows(from time.Time, to time.Time) ([]types.DowntimeWindow, error)
 	ListWindowsMatchingClusterFacts(ctx context.Context, from time.Time, to time.Time, clusterId string) ([]types.DowntimeWindow, error)
+	ListWindowsMatchingClusterFactsAsOf(ctx context.Context, from time.Time, to time.Time, clusterId string, asOf time.Time) ([]types.DowntimeWindow, error)
+}
+
+type ClusterLister interface {
+	// ListClusters returns the IDs of all clusters of the tenant or of all clusters if tenant is empty
+	ListClusters(ctx context.Context, tenant string) ([]string, error)
 }
 
 type PrometheusQuerier interface {
@@ -30,57 +147,389 @@ type PrometheusQuerier interface {
 }
 
 type queryServer struct {
-	lister DowntimeLister
-	prom   PrometheusQuerier
+	lister   DowntimeLister
+	prom     PrometheusQuerier
+	clusters ClusterLister
+	config   Config
+	now      func() time.Time
+}
+
+// queryParams are the parsed parameters shared by all SLI queries
+type queryParams struct {
+	from        time.Time
+	to          time.Time
+	step        time.Duration
+	stepName    string
+	missingData missingDataPolicy
+	weighting   string
+	filter      string
+	asOf        *time.Time
+	// ends contains the end of every step. Steps of a day or more follow the calendar,
+	// so a day with a DST change has 23 or 25 hours.
+	ends []time.Time
+	// promStep is the resolution of the Prometheus range queries, it has a sample at the end of every step
+	promStep time.Duration
+}
+
+func parseQueryParams(q url.Values, now time.Time) (queryParams, error) {
+	p := queryParams{}
+
+	p.stepName = q.Get("step")
+	if p.stepName == "" {
+		p.stepName = defaultStep
+	}
+	step, ok := steps[p.stepName]
+	if !ok {
+		return p, handler.NewErrWithCode(fmt.Errorf("unsupported `step` %q, expected one of %v", p.stepName, slices.Sorted(maps.Keys(steps))), http.StatusBadRequest)
+	}
+	p.step = step
+
+	loc := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return p, handler.NewErrWithCode(fmt.Errorf("invalid `tz`: %w", err), http.StatusBadRequest)
+		}
+		loc = l
+	}
+
+	var fromT, toT time.Time
+	if period := q.Get("period"); period != "" {
+		if q.Has("from") || q.Has("to") {
+			return p, handler.NewErrWithCode(errors.New("`period` can't be combined with `from` or `to`"), http.StatusBadRequest)
+		}
+		var err error
+		fromT, toT, err = resolvePeriod(period, now.In(loc))
+		if err != nil {
+			return p, handler.NewErrWithCode(err, http.StatusBadRequest)
+		}
+	} else {
+		from := q.Get("from")
+		var err error
+		fromT, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return p, fmt.Errorf("could not parse `from` time: %w", err)
+		}
+		to := q.Get("to")
+		toT, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return p, fmt.Errorf("could not parse `to` time: %w", err)
+		}
+		if q.Has("tz") {
+			fromT, toT = fromT.In(loc), toT.In(loc)
+		}
+	}
+	// steps of several days are aligned to the day of `from` instead of to multiples of the step since year 1
+	align := min(step, 24*time.Hour)
+	p.from = truncateInLocation(fromT, align)
+	p.to = truncateInLocation(toT, align)
+
+	p.missingData = missingDataPolicy(q.Get("missing_data"))
+	if p.missingData == "" {
+		p.missingData = missingDataGood
+	}
+	if !slices.Contains(missingDataPolicies, p.missingData) {
+		return p, handler.NewErrWithCode(fmt.Errorf("unsupported `missing_data` policy %q, expected one of %v", p.missingData, missingDataPolicies), http.StatusBadRequest)
+	}
+
+	p.weighting = q.Get("weighting")
+	if p.weighting == "" {
+		p.weighting = weightingHours
+	}
+	if p.weighting != weightingHours && p.weighting != weightingRequests {
+		return p, handler.NewErrWithCode(fmt.Errorf("unsupported `weighting` %q, expected %q or %q", p.weighting, weightingHours, weightingRequests), http.StatusBadRequest)
+	}
+
+	p.filter = q.Get("filter")
+	if p.filter == "" {
+		p.filter = ".*"
+	}
+
+	if asOf := q.Get("as_of"); asOf != "" {
+		asOfT, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return p, fmt.Errorf("could not parse `as_of` time: %w", err)
+		}
+		p.asOf = &asOfT
+	}
+
+	// Steps of a day or more end at midnight in the location of `from`. The recording rule still covers whole days,
+	// so the sample of a day with a DST change includes an hour of the previous day or misses its first hour.
+	stepEnd := func(i int) time.Time {
+		if days := int(step / (24 * time.Hour)); days > 0 {
+			return p.from.AddDate(0, 0, i*days)
+		}
+		return p.from.Add(time.Duration(i) * step)
+	}
+	if stepEnd(1).After(p.to) {
+		return p, fmt.Errorf("`to` must be at least one step (%s) after `from`", p.stepName)
+	}
+	for i := 1; !stepEnd(i).After(p.to); i++ {
+		p.ends = append(p.ends, stepEnd(i))
+	}
+	// a window which is not a multiple of the step, e.g. a month with a DST change and 6h steps,
+	// would either drop the remainder or misalign the steps with the calendar
+	if last := p.ends[len(p.ends)-1]; !last.Equal(p.to) {
+		return p, handler.NewErrWithCode(fmt.Errorf("the window from %s to %s is not a multiple of `step` %s, use a smaller step", p.from.Format(time.RFC3339), p.to.Format(time.RFC3339), p.stepName), http.StatusBadRequest)
+	}
+	// the steps of the current period after now have no data yet and would count as missing
+	if q.Has("period") && p.to.After(now) {
+		p.ends = slices.DeleteFunc(p.ends, func(end time.Time) bool { return end.After(now) })
+		if len(p.ends) == 0 {
+			return p, handler.NewErrWithCode(fmt.Errorf("the first step (%s) after `from` has not ended yet", p.stepName), http.StatusBadRequest)
+		}
+		p.to = p.ends[len(p.ends)-1]
+	}
+
+	for i, end := range p.ends {
+		p.promStep = gcd(p.promStep, end.Sub(p.stepStart(i)))
+	}
+	return p, nil
+}
+
+// stepStart returns the start of the step ending at ends[i]
+func (p queryParams) stepStart(i int) time.Time {
+	if i == 0 {
+		return p.from
+	}
+	return p.ends[i-1]
+}
+
+// gcd returns the greatest common divisor of a and b
+func gcd(a, b time.Duration) time.Duration {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+var (
+	monthPeriod    = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+	quarterPeriod  = regexp.MustCompile(`^(\d{4})-Q([1-4])$`)
+	lastDaysPeriod = regexp.MustCompile(`^last-(\d+)d$`)
+)
+
+// resolvePeriod returns the boundaries of a calendar month ("2026-09"), a quarter ("2026-Q3")
+// or the last days up to today's midnight ("last-30d") in the location of now.
+// Boundaries are calculated on the calendar and follow DST transitions.
+func resolvePeriod(period string, now time.Time) (time.Time, time.Time, error) {
+	loc := now.Location()
+	if m := monthPeriod.FindStringSubmatch(period); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		if month < 1 || month > 12 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid month in `period` %q", period)
+		}
+		from := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, loc)
+		return from, from.AddDate(0, 1, 0), nil
+	}
+	if m := quarterPeriod.FindStringSubmatch(period); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		quarter, _ := strconv.Atoi(m[2])
+		from := time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, loc)
+		return from, from.AddDate(0, 3, 0), nil
+	}
+	if m := lastDaysPeriod.FindStringSubmatch(period); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil || days <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid number of days in `period` %q", period)
+		}
+		to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		return to.AddDate(0, 0, -days), to, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unsupported `period` %q, expected a month (2006-01), a quarter (2006-Q1) or a number of days (last-30d)", period)
+}
+
+// truncateInLocation truncates t to a multiple of d relative to the UTC offset of t.
+// time.Truncate ignores the location, which misaligns hours with offsets such as +05:30 and days outside of UTC.
+func truncateInLocation(t time.Time, d time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(d).Add(-shift)
 }
 
 func (s *queryServer) QueryCluster(r *http.Request) (any, error) {
-	ctx := r.Context()
-	l := logr.FromContextOrDiscard(ctx)
+	p, err := parseQueryParams(r.URL.Query(), s.now())
+	if err != nil {
+		return nil, err
+	}
+	clusterID := r.PathValue("clusterid")
+	view := r.URL.Query().Get("view")
+	if view != "" && view != "summary" {
+		return nil, handler.NewErrWithCode(fmt.Errorf("unsupported `view` %q, expected \"summary\"", view), http.StatusBadRequest)
+	}
+
+	responses, err := s.queryClusters(r.Context(), p, []string{clusterID})
+	if err != nil {
+		return nil, err
+	}
+	if view == "summary" {
+		return QueryClusterSummary(responses[clusterID]), nil
+	}
+	return responses[clusterID], nil
+}
 
+func (s *queryServer) QueryClusterChart(r *http.Request) (any, error) {
+	slothID, ok := strings.CutSuffix(r.PathValue("chart"), ".svg")
+	if !ok {
+		return nil, handler.NewErrWithCode(errors.New("not found"), http.StatusNotFound)
+	}
+	p, err := parseQueryParams(r.URL.Query(), s.now())
+	if err != nil {
+		return nil, err
+	}
+	p.filter = regexp.QuoteMeta(slothID)
 	clusterID := r.PathValue("clusterid")
 
-	from := r.URL.Query().Get("from")
-	fromT, err := time.Parse(time.RFC3339, from)
+	responses, err := s.queryClusters(r.Context(), p, []string{clusterID})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := responses[clusterID].SLIData[slothID]; !ok {
+		return nil, handler.NewErrWithCode(fmt.Errorf("no SLI data for SLO %q on cluster %q", slothID, clusterID), http.StatusNotFound)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderBurnDownChart(&buf, responses[clusterID], slothID); err != nil {
+		return nil, err
+	}
+	return handler.RawResponse{ContentType: "image/svg+xml", Body: buf.Bytes()}, nil
+}
+
+func (s *queryServer) QueryTenant(r *http.Request) (any, error) {
+	p, err := parseQueryParams(r.URL.Query(), s.now())
+	if err != nil {
+		return nil, err
+	}
+	tenant := r.PathValue("tenant")
+
+	clusterIDs, err := s.clusters.ListClusters(r.Context(), tenant)
+	if err != nil {
+		return nil, fmt.Errorf("could not list clusters of tenant: %w", err)
+	}
+	if len(clusterIDs) == 0 {
+		return nil, handler.NewErrWithCode(fmt.Errorf("no clusters found for tenant %q", tenant), http.StatusNotFound)
+	}
+
+	res, err := s.queryFleet(r.Context(), p, clusterIDs)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse `from` time: %w", err)
+		return nil, err
 	}
-	fromT = fromT.Truncate(time.Hour)
-	to := r.URL.Query().Get("to")
-	toT, err := time.Parse(time.RFC3339, to)
+	res.Tenant = tenant
+	return res, nil
+}
+
+func (s *queryServer) QueryClusters(r *http.Request) (any, error) {
+	p, err := parseQueryParams(r.URL.Query(), s.now())
+	if err != nil {
+		return nil, err
+	}
+	clusterIDs := r.URL.Query()["cluster"]
+	if len(clusterIDs) == 0 {
+		return nil, handler.NewErrWithCode(errors.New("at least one `cluster` is required"), http.StatusBadRequest)
+	}
+	slices.Sort(clusterIDs)
+	clusterIDs = slices.Compact(clusterIDs)
+
+	known, err := s.clusters.ListClusters(r.Context(), "")
 	if err != nil {
-		return nil, fmt.Errorf("could not parse `to` time: %w", err)
+		return nil, fmt.Errorf("could not list clusters: %w", err)
+	}
+	unknown := slices.DeleteFunc(slices.Clone(clusterIDs), func(id string) bool { return slices.Contains(known, id) })
+	if len(unknown) > 0 {
+		return nil, handler.NewErrWithCode(fmt.Errorf("unknown clusters: %s", strings.Join(unknown, ", ")), http.StatusNotFound)
 	}
-	toT = toT.Truncate(time.Hour)
 
-	filter := r.URL.Query().Get("filter")
-	if filter == "" {
-		filter = ".*"
+	return s.queryFleet(r.Context(), p, clusterIDs)
+}
+
+func (s *queryServer) QuerySLO(r *http.Request) (any, error) {
+	p, err := parseQueryParams(r.URL.Query(), s.now())
+	if err != nil {
+		return nil, err
 	}
+	slothID := r.PathValue("sloth_id")
+	p.filter = regexp.QuoteMeta(slothID)
 
-	downtimes, err := s.lister.ListWindowsMatchingClusterFacts(ctx, fromT, toT, clusterID)
+	responses, err := s.queryClusters(r.Context(), p, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not list downtimes: %w", err)
+		return nil, err
 	}
 
-	hours := int(toT.Sub(fromT).Hours())
-	if hours <= 0 {
-		return nil, fmt.Errorf("`to` must be at least 1 hour after `from`")
+	res := QuerySLOResponse{
+		SlothID:   slothID,
+		From:      p.from,
+		To:        p.to,
+		Step:      p.stepName,
+		Weighting: p.weighting,
+		Clusters:  make([]QuerySLOClusterData, 0, len(responses)),
+	}
+	for clusterID, cr := range responses {
+		d, ok := cr.SLIData[slothID]
+		if !ok {
+			continue
+		}
+		res.Clusters = append(res.Clusters, QuerySLOClusterData{ClusterID: clusterID, QueryClusterResponseSLIData: d})
+	}
+	slices.SortFunc(res.Clusters, func(a, b QuerySLOClusterData) int {
+		return cmp.Or(
+			cmp.Compare(a.ErrorBudgetRemainingWindowPercentage, b.ErrorBudgetRemainingWindowPercentage),
+			cmp.Compare(a.ClusterID, b.ClusterID),
+		)
+	})
+	return res, nil
+}
+
+// queryFleet queries all given clusters and aggregates their results by SLO
+func (s *queryServer) queryFleet(ctx context.Context, p queryParams, clusterIDs []string) (QueryFleetResponse, error) {
+	responses, err := s.queryClusters(ctx, p, clusterIDs)
+	if err != nil {
+		return QueryFleetResponse{}, err
+	}
+	return QueryFleetResponse{
+		From:      p.from,
+		To:        p.to,
+		Step:      p.stepName,
+		Weighting: p.weighting,
+		Clusters:  responses,
+		Fleet:     aggregateFleet(responses, p.weighting),
+	}, nil
+}
+
+// queryClusters returns the SLI data of all given clusters.
+// Prometheus is queried once for all clusters and the downtimes are matched for each cluster.
+// Without clusterIDs, all clusters reporting SLI data are queried.
+func (s *queryServer) queryClusters(ctx context.Context, p queryParams, clusterIDs []string) (map[string]QueryClusterResponse, error) {
+	l := logr.FromContextOrDiscard(ctx)
+
+	var clusterMatcher *labels.Matcher
+	switch len(clusterIDs) {
+	case 0:
+		clusterMatcher = label.New(s.config.ClusterLabel).NotEqual("")
+	case 1:
+		clusterMatcher = label.New(s.config.ClusterLabel).Equal(clusterIDs[0])
+	default:
+		quoted := make([]string, len(clusterIDs))
+		for i, id := range clusterIDs {
+			quoted[i] = regexp.QuoteMeta(id)
+		}
+		clusterMatcher = label.New(s.config.ClusterLabel).EqualRegexp(strings.Join(quoted, "|"))
+	}
+	promRange := prometheusv1.Range{
+		Start: p.from,
+		End:   p.to,
+		Step:  p.promStep,
 	}
 
 	rawSamples, _, err := s.prom.QueryRange(
 		ctx,
 		vector.New(
-			vector.WithMetricName("slo:sli_error:ratio_rate1h"),
+			vector.WithMetricName(s.config.ErrorRatioMetricPrefix+p.stepName),
 			vector.WithLabelMatchers(
-				label.New("cluster_id").Equal(clusterID),
-				label.New(SLOTH_ID_LABEL).EqualRegexp(filter),
+				clusterMatcher,
+				label.New(s.config.SlothIDLabel).EqualRegexp(p.filter),
 			)).String(),
-		prometheusv1.Range{
-			Start: fromT,
-			End:   toT,
-			Step:  time.Hour,
-		})
+		promRange)
 	if err != nil {
 		return nil, fmt.Errorf("could not query Prometheus: %w", err)
 	}
@@ -89,137 +538,723 @@ func (s *queryServer) QueryCluster(r *http.Request) (any, error) {
 		return nil, fmt.Errorf("unexpected result type from Prometheus (expected model.Matrix, got %T)", rawSamples)
 	}
 
-	rawObjective, _, err := s.prom.Query(
+	rawObjective, _, err := s.prom.QueryRange(
 		ctx,
 		vector.New(
-			vector.WithMetricName("slo:objective:ratio"),
+			vector.WithMetricName(s.config.ObjectiveMetric),
 			vector.WithLabelMatchers(
-				label.New("cluster_id").Equal(clusterID),
-				label.New(SLOTH_ID_LABEL).EqualRegexp(filter),
-			)).String(), toT)
+				clusterMatcher,
+				label.New(s.config.SlothIDLabel).EqualRegexp(p.filter),
+			)).String(),
+		promRange)
 	if err != nil {
 		return nil, fmt.Errorf("could not query Prometheus for objective: %w", err)
 	}
-	objectives, ok := rawObjective.(model.Vector)
+	objectives, ok := rawObjective.(model.Matrix)
 	if !ok {
-		return nil, fmt.Errorf("unexpected result type from Prometheus for objective (expected model.Vector, got %T)", rawObjective)
+		return nil, fmt.Errorf("unexpected result type from Prometheus for objective (expected model.Matrix, got %T)", rawObjective)
 	}
-	objectiveMap := make(map[string]float64)
+	// an SLO can have several objective series, e.g. if the labels of the recording rule changed, they are merged by timestamp
+	objectiveSamples := make(map[string]map[string]map[model.Time]model.SampleValue)
 	for _, sample := range objectives {
-		name := string(sample.Metric[SLOTH_ID_LABEL])
+		cluster := s.clusterOf(sample.Metric, clusterIDs)
+		name := string(sample.Metric[model.LabelName(s.config.SlothIDLabel)])
 		if name == "" {
 			l.Info("Found objective sample without sloth_id label, skipping", "metric", sample.Metric)
 			continue
 		}
-		objectiveMap[name] = float64(sample.Value)
+		if objectiveSamples[cluster] == nil {
+			objectiveSamples[cluster] = make(map[string]map[model.Time]model.SampleValue)
+		}
+		if objectiveSamples[cluster][name] != nil {
+			l.Info("Found multiple objective series for SLO, merging them", "cluster", cluster, "slo", name, "metric", sample.Metric)
+		} else {
+			objectiveSamples[cluster][name] = make(map[model.Time]model.SampleValue)
+		}
+		for _, pair := range sample.Values {
+			if math.IsNaN(float64(pair.Value)) {
+				continue
+			}
+			// if the series disagree, the stricter objective wins
+			if v, ok := objectiveSamples[cluster][name][pair.Timestamp]; !ok || pair.Value > v {
+				objectiveSamples[cluster][name][pair.Timestamp] = pair.Value
+			}
+		}
+	}
+	objectiveMap := make(map[string]map[string]objectiveSeries, len(objectiveSamples))
+	for cluster, byName := range objectiveSamples {
+		objectiveMap[cluster] = make(map[string]objectiveSeries, len(byName))
+		for name, samples := range byName {
+			if len(samples) > 0 {
+				objectiveMap[cluster][name] = newObjectiveSeries(samples)
+			}
+		}
 	}
 
+	// the clusters found in Prometheus are not known to exist, one of them must not fail the query of all others
+	discovered := len(clusterIDs) == 0
+	if discovered {
+		for _, sample := range samples {
+			cluster := s.clusterOf(sample.Metric, nil)
+			if cluster == "" {
+				l.Info("Found sample without cluster label, skipping", "metric", sample.Metric)
+				continue
+			}
+			clusterIDs = append(clusterIDs, cluster)
+		}
+		slices.Sort(clusterIDs)
+		clusterIDs = slices.Compact(clusterIDs)
+	}
+
+	downtimes := make(map[string][]types.DowntimeWindow, len(clusterIDs))
+	downtimeWarnings := make(map[string]string)
+	for _, clusterID := range clusterIDs {
+		var err error
+		if p.asOf != nil {
+			downtimes[clusterID], err = s.lister.ListWindowsMatchingClusterFactsAsOf(ctx, p.from, p.to, clusterID, *p.asOf)
+		} else {
+			downtimes[clusterID], err = s.lister.ListWindowsMatchingClusterFacts(ctx, p.from, p.to, clusterID)
+		}
+		if err != nil && discovered {
+			l.Error(err, "Could not list downtimes for cluster, no downtime is excluded", "cluster", clusterID)
+			downtimes[clusterID] = []types.DowntimeWindow{}
+			downtimeWarnings[clusterID] = "could not list the downtimes of the cluster, no downtime is excluded"
+		} else if err != nil {
+			return nil, fmt.Errorf("could not list downtimes for cluster %q: %w", clusterID, err)
+		}
+	}
+
+	samplesByCluster := make(map[string]model.Matrix, len(clusterIDs))
+	for _, sample := range samples {
+		cluster := s.clusterOf(sample.Metric, clusterIDs)
+		samplesByCluster[cluster] = append(samplesByCluster[cluster], sample)
+	}
+
+	events := make(map[string]map[string]map[model.Time]float64)
+	if p.weighting == weightingRequests {
+		events, err = s.queryEvents(ctx, clusterMatcher, clusterIDs, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	responses := make(map[string]QueryClusterResponse, len(clusterIDs))
+	for _, clusterID := range clusterIDs {
+		res := s.clusterResponse(l, p, clusterID, samplesByCluster[clusterID], objectiveMap[clusterID], events[clusterID], downtimes[clusterID])
+		if warning, ok := downtimeWarnings[clusterID]; ok {
+			for name, d := range res.SLIData {
+				d.Warnings = append(d.Warnings, warning)
+				res.SLIData[name] = d
+			}
+		}
+		responses[clusterID] = res
+	}
+	return responses, nil
+}
+
+// clusterOf returns the cluster of the series. Series without cluster label belong to the only queried cluster.
+func (s *queryServer) clusterOf(metric model.Metric, clusterIDs []string) string {
+	if c, ok := metric[model.LabelName(s.config.ClusterLabel)]; ok || len(clusterIDs) != 1 {
+		return string(c)
+	}
+	return clusterIDs[0]
+}
+
+// clusterResponse calculates the SLI data of a single cluster
+func (s *queryServer) clusterResponse(l logr.Logger, p queryParams, clusterID string, samples model.Matrix, objectiveMap map[string]objectiveSeries, events map[string]map[model.Time]float64, downtimes []types.DowntimeWindow) QueryClusterResponse {
+	toT, missingData, weighting := p.to, p.missingData, p.weighting
+
 	response := QueryClusterResponse{
 		ClusterID: clusterID,
+		From:      p.from,
+		To:        p.to,
+		Step:      p.stepName,
+		Weighting: weighting,
+		Downtimes: downtimes,
 		SLIData:   make(map[string]QueryClusterResponseSLIData),
 	}
 
+	// weightsByName contains the weight of each step in the error budget of the window
+	weightsByName := make(map[string]map[model.Time]float64)
 	for _, sample := range samples {
-		name := string(sample.Metric[SLOTH_ID_LABEL])
+		name := string(sample.Metric[model.LabelName(s.config.SlothIDLabel)])
 		if name == "" {
 			l.Info("Found sample without sloth_id label, skipping", "metric", sample.Metric)
 			continue
 		}
 		d := response.SLIData[name]
-		cumulative_sum := 0.0
-		cumulative_real_sum := 0.0
+		sloDowntimes := s.downtimesForSeries(downtimes, sample.Metric)
+		sloWeighting := weighting
+		if weighting == weightingRequests && events[name] == nil {
+			// without events every step would have a weight of 0 and the SLO would look perfect
+			sloWeighting = weightingHours
+			warning := fmt.Sprintf("no %s series found, the steps are weighted by hours instead of requests", s.config.EventsMetric)
+			if !slices.Contains(d.Warnings, warning) {
+				d.Warnings = append(d.Warnings, warning)
+			}
+		}
 
+		values := make(map[model.Time]float64, len(sample.Values))
 		for _, pair := range sample.Values {
-			val := float64(pair.Value)
-			realval := float64(pair.Value)
-			if timeMatchesDowntimeWindow(pair.Timestamp.Time(), downtimes) {
-				val = 0
-			}
-			if math.IsNaN(realval) {
-				val = 0
-				realval = 0
-			}
-			cumulative_sum = cumulative_sum + val
-			cumulative_real_sum = cumulative_real_sum + realval
-			d.DataPoints = append(d.DataPoints, SLIDataPoint{
-				Timestamp:                      pair.Timestamp.Time(),
+			values[pair.Timestamp] = float64(pair.Value)
+		}
+
+		// In the hours weighting every step is weighted by its length and excluded time counts as without errors.
+		// In the requests weighting every step is weighted by its events and excluded events are removed.
+		weights := make(map[model.Time]float64, len(p.ends))
+		realWeights := make(map[model.Time]float64, len(p.ends))
+		missing := make(map[model.Time]bool)
+		var total, realTotal float64
+		var missingTime time.Duration
+		for i, end := range p.ends {
+			ts := model.TimeFromUnixNano(end.UnixNano())
+			step := end.Sub(p.stepStart(i))
+			if v, ok := values[ts]; !ok || math.IsNaN(v) {
+				missing[ts] = true
+				missingTime += step
+			}
+			w := step.Hours()
+			if sloWeighting == weightingRequests {
+				w = events[name][ts]
+			}
+			if missing[ts] && missingData == missingDataExclude {
+				w = 0
+			}
+			realWeights[ts] = w
+			if sloWeighting == weightingRequests {
+				w = w * (1 - excludedFraction(ts.Time(), step, sloDowntimes))
+			}
+			weights[ts] = w
+			total += weights[ts]
+			realTotal += realWeights[ts]
+		}
+		weightsByName[name] = weights
+		d.MissingHours = missingTime.Hours()
+
+		cumulative_sum := 0.0
+		cumulative_real_sum := 0.0
+		windowsByID := make(map[string]types.DowntimeWindow, len(sloDowntimes))
+		for _, w := range sloDowntimes {
+			windowsByID[w.ID] = w
+		}
+		attributions := map[string]int{}
+		// walk all steps, as absent samples count according to the missing data policy
+		for i, end := range p.ends {
+			ts := model.TimeFromUnixNano(end.UnixNano())
+			step := end.Sub(p.stepStart(i))
+			realval, present := values[ts]
+			if missing[ts] {
+				realval = missingData.errorRate()
+			}
+			excluded := excludedFraction(ts.Time(), step, sloDowntimes)
+			byWindow := excludedByWindow(ts.Time(), step, sloDowntimes)
+			windowIDs := slices.Sorted(maps.Keys(byWindow))
+			for _, id := range windowIDs {
+				idx, ok := attributions[id]
+				if !ok {
+					w := windowsByID[id]
+					idx = len(d.DowntimeAttribution)
+					attributions[id] = idx
+					d.DowntimeAttribution = append(d.DowntimeAttribution, DowntimeAttribution{WindowID: id, Title: w.Title, ExternalLink: w.ExternalLink})
+				}
+				d.DowntimeAttribution[idx].HoursExcluded += byWindow[id] * step.Hours()
+				// the share of the real error rate of the window which is not counted because of the downtime
+				d.DowntimeAttribution[idx].ErrorBudgetRecovered += ratio(realval*byWindow[id]*realWeights[ts], realTotal)
+			}
+			val := realval * (1 - excluded)
+			if sloWeighting == weightingRequests {
+				cumulative_sum = cumulative_sum + realval*weights[ts]
+				d.TotalEvents += weights[ts]
+				d.ErrorEvents += realval * weights[ts]
+			} else {
+				cumulative_sum = cumulative_sum + val*weights[ts]
+			}
+			cumulative_real_sum = cumulative_real_sum + realval*realWeights[ts]
+			if !present {
+				continue
+			}
+			dp := SLIDataPoint{
+				Timestamp:                      ts.Time(),
 				ErrorRate1h:                    val,
 				RealErrorRate1h:                realval,
-				CumulativeAverageErrorRate:     cumulative_sum / float64(hours),
-				CumulativeAverageRealErrorRate: cumulative_real_sum / float64(hours),
-			})
+				CumulativeAverageErrorRate:     ratio(cumulative_sum, total),
+				CumulativeAverageRealErrorRate: ratio(cumulative_real_sum, realTotal),
+				ExcludedFraction:               excluded,
+				Missing:                        missing[ts],
+				DowntimeIDs:                    windowIDs,
+			}
+			if sloWeighting == weightingRequests {
+				dp.TotalEvents = events[name][ts]
+			}
+			d.DataPoints = append(d.DataPoints, dp)
 		}
+		d.ErrorRateWindow = ratio(cumulative_sum, total)
 		response.SLIData[name] = d
 	}
 
 	for name, d := range response.SLIData {
-		obj, ok := objectiveMap[name]
+		objs, ok := objectiveMap[name]
 		if !ok {
 			l.Info("Warning: Could not find objective for service", "service", name)
 			continue
 		}
-		d.Objective = obj
-		var sum float64
-		for _, dp := range d.DataPoints {
-			sum += dp.ErrorRate1h
+		d.Objective = objs.at(toT)
+		d.ObjectiveChanges = objs.changes()
+		// the error budget of each step depends on the objective active during that step
+		var budget, total float64
+		for _, end := range p.ends {
+			w := weightsByName[name][model.TimeFromUnixNano(end.UnixNano())]
+			budget += (1.0 - objs.at(end)) * w
+			total += w
+		}
+		if total > 0 {
+			budget = budget / total
+		} else {
+			// there is nothing to weigh, e.g. if all data is missing and excluded
+			budget = 1.0 - d.Objective
+		}
+		for i, dp := range d.DataPoints {
+			obj := objs.at(dp.Timestamp)
+			d.DataPoints[i].Objective = obj
+			d.DataPoints[i].ErrorBudgetRemaining = 1.0 - obj - dp.ErrorRate1h
 		}
-		d.ErrorRateWindow = sum / float64(hours)
-		d.ErrorBudgetRemainingWindow = 1.0 - d.Objective - d.ErrorRateWindow
-		d.ErrorBudgetRemainingWindowPercentage = d.ErrorBudgetRemainingWindow / (1.0 - d.Objective)
+		d.ErrorBudgetRemainingWindow = budget - d.ErrorRateWindow
+		d.ErrorBudgetRemainingWindowPercentage = d.ErrorBudgetRemainingWindow / budget
 		response.SLIData[name] = d
 	}
 
-	return response, nil
+	return response
 }
 
 type QueryClusterResponse struct {
 	ClusterID string `json:"cluster_id"`
+	// From and To are the resolved boundaries of the queried window
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Step is the resolution of the data points, e.g. "1h"
+	Step string `json:"step"`
+	// Weighting is either "hours" if every step has the same weight or "requests" if steps are weighted by their number of events
+	Weighting string `json:"weighting"`
+	// Downtimes are the downtime windows matching the cluster within the window.
+	// Windows with an SLO selector only apply to the matching SLOs, see DowntimeAttribution.
+	Downtimes []types.DowntimeWindow `json:"downtimes"`
 
 	SLIData map[string]QueryClusterResponseSLIData `json:"sli_data"`
 }
 
+type QuerySLOResponse struct {
+	SlothID string    `json:"sloth_id"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	// Step is the resolution of the data points, e.g. "1h"
+	Step string `json:"step"`
+	// Weighting is either "hours" or "requests", see QueryClusterResponse
+	Weighting string `json:"weighting"`
+	// Clusters contains the SLI data of every cluster reporting the SLO,
+	// ranked by remaining error budget percentage from the lowest to the highest.
+	Clusters []QuerySLOClusterData `json:"clusters"`
+}
+
+type QuerySLOClusterData struct {
+	ClusterID string `json:"cluster_id"`
+	QueryClusterResponseSLIData
+}
+
+type QueryFleetResponse struct {
+	// Tenant is set for tenant queries
+	Tenant string    `json:"tenant,omitempty"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Step is the resolution of the data points, e.g. "1h"
+	Step string `json:"step"`
+	// Weighting is either "hours" or "requests", see QueryClusterResponse
+	Weighting string `json:"weighting"`
+	// Clusters contains the results of each cluster by cluster ID
+	Clusters map[string]QueryClusterResponse `json:"clusters"`
+	// Fleet contains the results aggregated over all clusters by SLO
+	Fleet map[string]QueryFleetSLIData `json:"fleet"`
+}
+
+type QueryFleetSLIData struct {
+	// Clusters is the number of clusters with data for this SLO
+	Clusters int `json:"clusters"`
+	// ErrorRateWindow is the average error rate of all clusters.
+	// With the requests weighting, clusters are weighted by their number of events.
+	ErrorRateWindow float64 `json:"error_rate_window"`
+	// ErrorBudgetRemainingWindow is the average error budget of all clusters with an objective minus ErrorRateWindow.
+	ErrorBudgetRemainingWindow float64 `json:"error_budget_remaining_window"`
+	// ErrorBudgetRemainingWindowPercentage is ErrorBudgetRemainingWindow divided by the average error budget.
+	ErrorBudgetRemainingWindowPercentage float64 `json:"error_budget_remaining_window_percent"`
+	// TotalEvents and ErrorEvents are the sums of all clusters. They are only set with the requests weighting.
+	TotalEvents float64 `json:"total_events,omitempty"`
+	ErrorEvents float64 `json:"error_events,omitempty"`
+	// Warnings lists the warnings of the clusters, prefixed by the cluster ID.
+	// With the requests weighting, clusters without events have no weight.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
 type QueryClusterResponseSLIData struct {
-	// Objective is the SLO objective for this service, e.g. 0.98 for 98%
+	// Objective is the SLO objective for this service at the end of the window, e.g. 0.98 for 98%
 	Objective float64 `json:"objective"`
+	// ObjectiveChanges lists the changes of the objective within the window.
+	ObjectiveChanges []ObjectiveChange `json:"objective_changes"`
 	// ErrorRateWindow is the average error rate over the entire window.
-	// Null time points are treated as 0 error rate.
+	// Missing data is treated according to the `missing_data` policy, by default as 0 error rate.
+	// With the requests weighting it is the ratio of error events to total events, without the events during downtimes.
 	ErrorRateWindow float64 `json:"error_rate_window"`
 	// ErrorBudgetRemainingWindow is the remaining error budget over the entire window.
-	// It is calculated as (1 - objective) - ErrorRateWindow.
+	// It is calculated as (average of (1 - objective) over all steps) - ErrorRateWindow,
+	// with the objective that was active during each step.
 	// It can be negative if the error rate exceeded the objective.
 	ErrorBudgetRemainingWindow float64 `json:"error_budget_remaining_window"`
 	// ErrorBudgetRemainingWindowPercentage is the percentage of the error budget remaining calculated over the entire window.
-	// It is calculated as ErrorBudgetWindow / (1 - objective).
+	// It is calculated as ErrorBudgetWindow / (average of (1 - objective) over all steps).
 	// It can be negative if the error rate exceeded the objective.
 	ErrorBudgetRemainingWindowPercentage float64 `json:"error_budget_remaining_window_percent"`
-	// DataPoints contains the error rate for each hour in the window.
+	// MissingHours is the time in hours without SLI data, because there was no sample or the sample was NaN.
+	// Missing data is counted according to the `missing_data` policy of the query.
+	MissingHours float64 `json:"missing_hours"`
+	// TotalEvents and ErrorEvents are the number of events in the window without the events during downtimes.
+	// They are only set with the requests weighting.
+	TotalEvents float64 `json:"total_events,omitempty"`
+	ErrorEvents float64 `json:"error_events,omitempty"`
+	// DowntimeAttribution lists the downtime windows applied to this SLO in the order they first affected it.
+	DowntimeAttribution []DowntimeAttribution `json:"downtime_attribution"`
+	// Warnings lists why the data may not be what the query asked for, e.g. if the requests weighting fell back to hours.
+	Warnings []string `json:"warnings,omitempty"`
+	// DataPoints contains the error rate for each step in the window.
 	DataPoints []SLIDataPoint `json:"data_points"`
 }
 
+type DowntimeAttribution struct {
+	WindowID     string `json:"window_id"`
+	Title        string `json:"title"`
+	ExternalLink string `json:"external_link,omitempty"`
+	// HoursExcluded is the time excluded by the window. Time covered by several windows is split evenly between them.
+	HoursExcluded float64 `json:"hours_excluded"`
+	// ErrorBudgetRecovered is the part of the real error rate of the window not counted because of this downtime window.
+	// With the hours weighting, the values of all windows add up to the difference between the real and the adjusted error rate.
+	ErrorBudgetRecovered float64 `json:"error_budget_recovered"`
+}
+
 type SLIDataPoint struct {
 	// Timestamp is the time of the data point as provided by Prometheus.
 	Timestamp time.Time `json:"timestamp"`
-	// ErrorRate1h is the error rate for the past hour adjusted for downtimes.
+	// ErrorRate1h is the error rate for the past step adjusted for downtimes.
+	// The name is kept for compatibility, the data point covers the step of the query, which defaults to 1h.
+	// It is calculated as: real_error_rate_1h * (1 - excluded_fraction)
 	ErrorRate1h float64 `json:"error_rate_1h"`
-	// RealErrorRate1h is the raw error rate for the past hour as reported by Prometheus.
+	// RealErrorRate1h is the raw error rate for the past step as reported by Prometheus.
 	RealErrorRate1h float64 `json:"real_error_rate_1h"`
-	// CumulativeAverageErrorRate is the cumulative error rate since the beginning of the time window, averaged over the number of hours in the time window. It is calculated as: (sum of `error_rate_1h` up until including now) / (total number of hours in the entire timeframe)
+	// CumulativeAverageErrorRate is the cumulative error rate since the beginning of the time window, averaged over the number of steps in the time window. It is calculated as: (sum of `error_rate_1h` up until including now) / (total number of steps in the entire timeframe)
 	CumulativeAverageErrorRate float64 `json:"cumulative_average_error_rate"`
-	// CumulativeAverageRealErrorRate is the cumulative real error rate since the beginning of the time window, averaged over the number of hours in the time window. It is calculated as: (sum of `real_error_rate_1h` up until including now) / (total number of hours in the entire timeframe)
+	// CumulativeAverageRealErrorRate is the cumulative real error rate since the beginning of the time window, averaged over the number of steps in the time window. It is calculated as: (sum of `real_error_rate_1h` up until including now) / (total number of steps in the entire timeframe)
 	CumulativeAverageRealErrorRate float64 `json:"cumulative_average_real_error_rate"`
+	// ExcludedFraction is the fraction of the past step covered by downtime windows, between 0 and 1.
+	ExcludedFraction float64 `json:"excluded_fraction"`
+	// TotalEvents is the number of events within the past step. It is only set with the requests weighting.
+	TotalEvents float64 `json:"total_events,omitempty"`
+	// Missing is true if the sample was NaN. The error rates are set according to the `missing_data` policy.
+	Missing bool `json:"missing,omitempty"`
+	// Objective is the SLO objective active at the time of the data point.
+	Objective float64 `json:"objective"`
+	// ErrorBudgetRemaining is the error budget remaining for the past step. It is calculated as (1 - objective) - error_rate_1h.
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+	// DowntimeIDs are the IDs of the downtime windows excluded from the past step.
+	DowntimeIDs []string `json:"downtime_ids,omitempty"`
+}
+
+type ObjectiveChange struct {
+	// Timestamp is the time of the first sample with the new objective.
+	Timestamp time.Time `json:"timestamp"`
+	Previous  float64   `json:"previous"`
+	Objective float64   `json:"objective"`
+}
+
+// objectiveSeries contains the objective samples of an SLO ordered by time
+type objectiveSeries []model.SamplePair
+
+// newObjectiveSeries returns the samples ordered by time
+func newObjectiveSeries(samples map[model.Time]model.SampleValue) objectiveSeries {
+	o := make(objectiveSeries, 0, len(samples))
+	for ts, v := range samples {
+		o = append(o, model.SamplePair{Timestamp: ts, Value: v})
+	}
+	slices.SortFunc(o, func(a, b model.SamplePair) int { return cmp.Compare(a.Timestamp, b.Timestamp) })
+	return o
+}
+
+// at returns the objective active at ts. That is the last sample at or before ts or the first sample if there is none.
+func (o objectiveSeries) at(ts time.Time) float64 {
+	i, _ := slices.BinarySearchFunc(o, model.TimeFromUnixNano(ts.UnixNano()), func(p model.SamplePair, t model.Time) int {
+		// find the first sample after ts
+		if p.Timestamp <= t {
+			return -1
+		}
+		return 1
+	})
+	return float64(o[max(i-1, 0)].Value)
+}
+
+// changes returns all samples with a different objective than the previous sample
+func (o objectiveSeries) changes() []ObjectiveChange {
+	changes := []ObjectiveChange{}
+	for i := 1; i < len(o); i++ {
+		if o[i].Value != o[i-1].Value {
+			changes = append(changes, ObjectiveChange{
+				Timestamp: o[i].Timestamp.Time(),
+				Previous:  float64(o[i-1].Value),
+				Objective: float64(o[i].Value),
+			})
+		}
+	}
+	return changes
 }
 
-func Setup(mux *http.ServeMux, lister DowntimeLister, prom PrometheusQuerier) {
-	s := queryServer{lister: lister, prom: prom}
+func Setup(mux *http.ServeMux, lister DowntimeLister, prom PrometheusQuerier, clusters ClusterLister, config Config) {
+	s := newQueryServer(lister, prom, clusters, config)
+	mux.Handle("GET /query", handler.JSONFunc(s.QueryClusters))
 	mux.Handle("GET /query/cluster/{clusterid}", handler.JSONFunc(s.QueryCluster))
+	// ServeMux wildcards must span a whole segment, the chart handler strips the .svg suffix
+	mux.Handle("GET /query/cluster/{clusterid}/chart/{chart}", handler.JSONFunc(s.QueryClusterChart))
+	mux.Handle("GET /query/tenant/{tenant}", handler.JSONFunc(s.QueryTenant))
+	mux.Handle("GET /query/slo/{sloth_id}", handler.JSONFunc(s.QuerySLO))
+}
+
+func newQueryServer(lister DowntimeLister, prom PrometheusQuerier, clusters ClusterLister, config Config) *queryServer {
+	return &queryServer{lister: lister, prom: prom, clusters: clusters, config: config.withDefaults(), now: time.Now}
+}
+
+// Querier queries the SLI data of clusters outside of the HTTP API, e.g. to render reports
+type Querier struct {
+	s *queryServer
+}
+
+func NewQuerier(lister DowntimeLister, prom PrometheusQuerier, clusters ClusterLister, config Config) *Querier {
+	return &Querier{s: newQueryServer(lister, prom, clusters, config)}
+}
+
+// QueryCluster returns the SLI data of the cluster.
+// The parameters are the same as the query parameters of `GET /query/cluster/{clusterid}`.
+func (q *Querier) QueryCluster(ctx context.Context, clusterID string, params url.Values) (QueryClusterResponse, error) {
+	p, err := parseQueryParams(params, q.s.now())
+	if err != nil {
+		return QueryClusterResponse{}, err
+	}
+	responses, err := q.s.queryClusters(ctx, p, []string{clusterID})
+	if err != nil {
+		return QueryClusterResponse{}, err
+	}
+	return responses[clusterID], nil
+}
+
+// queryEvents returns the number of events within each step by cluster and SLO
+func (s *queryServer) queryEvents(ctx context.Context, clusterMatcher *labels.Matcher, clusterIDs []string, p queryParams) (map[string]map[string]map[model.Time]float64, error) {
+	raw, _, err := s.prom.QueryRange(
+		ctx,
+		promqlbuilder.Sum(
+			promqlbuilder.Increase(
+				matrix.New(
+					vector.New(
+						vector.WithMetricName(s.config.EventsMetric),
+						vector.WithLabelMatchers(
+							clusterMatcher,
+							label.New(s.config.SlothIDLabel).EqualRegexp(p.filter),
+						)),
+					matrix.WithRangeAsString(p.stepName),
+				),
+			),
+		).By(s.config.ClusterLabel, s.config.SlothIDLabel).String(),
+		prometheusv1.Range{
+			Start: p.from,
+			End:   p.to,
+			Step:  p.promStep,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("could not query Prometheus for events: %w", err)
+	}
+	m, ok := raw.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type from Prometheus for events (expected model.Matrix, got %T)", raw)
+	}
+	events := make(map[string]map[string]map[model.Time]float64)
+	for _, sample := range m {
+		cluster := s.clusterOf(sample.Metric, clusterIDs)
+		name := string(sample.Metric[model.LabelName(s.config.SlothIDLabel)])
+		if events[cluster] == nil {
+			events[cluster] = make(map[string]map[model.Time]float64)
+		}
+		if events[cluster][name] == nil {
+			events[cluster][name] = make(map[model.Time]float64, len(sample.Values))
+		}
+		for _, pair := range sample.Values {
+			if !math.IsNaN(float64(pair.Value)) {
+				events[cluster][name][pair.Timestamp] = float64(pair.Value)
+			}
+		}
+	}
+	return events, nil
+}
+
+// aggregateFleet aggregates the SLI data of all clusters by SLO.
+// The clusters are weighted equally, or by their number of events with the requests weighting.
+func aggregateFleet(responses map[string]QueryClusterResponse, weighting string) map[string]QueryFleetSLIData {
+	type sums struct {
+		rate, budget, weight, budgetWeight float64
+	}
+	bySLO := make(map[string]sums)
+	fleet := make(map[string]QueryFleetSLIData)
+	for clusterID, res := range responses {
+		for name, d := range res.SLIData {
+			f := fleet[name]
+			sum := bySLO[name]
+			for _, w := range d.Warnings {
+				f.Warnings = append(f.Warnings, fmt.Sprintf("cluster %s: %s", clusterID, w))
+			}
+			w := 1.0
+			if weighting == weightingRequests {
+				w = d.TotalEvents
+				f.TotalEvents += d.TotalEvents
+				f.ErrorEvents += d.ErrorEvents
+			}
+			f.Clusters++
+			sum.rate += d.ErrorRateWindow * w
+			sum.weight += w
+			if d.Objective > 0 {
+				// the error budget of the cluster, see QueryClusterResponseSLIData
+				sum.budget += (d.ErrorBudgetRemainingWindow + d.ErrorRateWindow) * w
+				sum.budgetWeight += w
+			}
+			fleet[name] = f
+			bySLO[name] = sum
+		}
+	}
+	for name, f := range fleet {
+		sum := bySLO[name]
+		slices.Sort(f.Warnings)
+		f.ErrorRateWindow = ratio(sum.rate, sum.weight)
+		if sum.budgetWeight > 0 {
+			budget := sum.budget / sum.budgetWeight
+			f.ErrorBudgetRemainingWindow = budget - f.ErrorRateWindow
+			f.ErrorBudgetRemainingWindowPercentage = ratio(f.ErrorBudgetRemainingWindow, budget)
+		}
+		fleet[name] = f
+	}
+	return fleet
+}
+
+// ratio returns a / b or 0 if b is 0
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
 }
 
-// as Prometheus looks back in time from T the window is matched as such: (windows.start, windows.end]
-func timeMatchesDowntimeWindow(ts time.Time, windows []types.DowntimeWindow) bool {
+// excludedFraction returns the fraction of the bucket (ts-step, ts] covered by the downtime windows.
+// Prometheus looks back in time from ts, so the sample at ts covers the step before it.
+// Overlapping windows are merged, so time covered by several windows is only counted once.
+func excludedFraction(ts time.Time, step time.Duration, windows []types.DowntimeWindow) float64 {
+	bucketStart := ts.Add(-step)
+
+	type interval struct{ start, end time.Time }
+	intervals := make([]interval, 0, len(windows))
+	for _, w := range windows {
+		start, end := bucketStart, ts
+		if w.StartTime != nil && w.StartTime.After(start) {
+			start = *w.StartTime
+		}
+		if w.EndTime != nil && w.EndTime.Before(end) {
+			end = *w.EndTime
+		}
+		if end.After(start) {
+			intervals = append(intervals, interval{start, end})
+		}
+	}
+	if len(intervals) == 0 {
+		return 0
+	}
+	slices.SortFunc(intervals, func(a, b interval) int { return a.start.Compare(b.start) })
+
+	var covered time.Duration
+	cur := intervals[0]
+	for _, i := range intervals[1:] {
+		if i.start.After(cur.end) {
+			covered += cur.end.Sub(cur.start)
+			cur = i
+			continue
+		}
+		if i.end.After(cur.end) {
+			cur.end = i.end
+		}
+	}
+	covered += cur.end.Sub(cur.start)
+	return min(covered.Seconds()/step.Seconds(), 1)
+}
+
+// excludedByWindow returns the fraction of the step ending at ts covered by each window, by window ID.
+// Time covered by several windows is split evenly between them, so the fractions add up to excludedFraction.
+func excludedByWindow(ts time.Time, step time.Duration, windows []types.DowntimeWindow) map[string]float64 {
+	bucketStart := ts.Add(-step)
+
+	type interval struct {
+		id         string
+		start, end time.Time
+	}
+	intervals := make([]interval, 0, len(windows))
+	bounds := []time.Time{}
+	for _, w := range windows {
+		start, end := bucketStart, ts
+		if w.StartTime != nil && w.StartTime.After(start) {
+			start = *w.StartTime
+		}
+		if w.EndTime != nil && w.EndTime.Before(end) {
+			end = *w.EndTime
+		}
+		if end.After(start) {
+			intervals = append(intervals, interval{w.ID, start, end})
+			bounds = append(bounds, start, end)
+		}
+	}
+	if len(intervals) == 0 {
+		return nil
+	}
+	slices.SortFunc(bounds, func(a, b time.Time) int { return a.Compare(b) })
+	bounds = slices.CompactFunc(bounds, func(a, b time.Time) bool { return a.Equal(b) })
+
+	fractions := make(map[string]float64)
+	for i := 1; i < len(bounds); i++ {
+		segStart, segEnd := bounds[i-1], bounds[i]
+		covering := []string{}
+		for _, iv := range intervals {
+			if !iv.start.After(segStart) && !iv.end.Before(segEnd) {
+				covering = append(covering, iv.id)
+			}
+		}
+		for _, id := range covering {
+			fractions[id] += segEnd.Sub(segStart).Seconds() / step.Seconds() / float64(len(covering))
+		}
+	}
+	return fractions
+}
+
+// downtimesForSeries returns the windows whose SLO selector matches the labels of the series
+func (s *queryServer) downtimesForSeries(windows []types.DowntimeWindow, metric model.Metric) []types.DowntimeWindow {
+	labels := map[string]string{}
+	for selectorLabel, seriesLabel := range map[string]string{
+		"sloth_id":      s.config.SlothIDLabel,
+		"sloth_service": s.config.SlothServiceLabel,
+		"sloth_slo":     s.config.SlothSLOLabel,
+	} {
+		if v, ok := metric[model.LabelName(seriesLabel)]; ok {
+			labels[selectorLabel] = string(v)
+		}
+	}
+	matching := []types.DowntimeWindow{}
 	for _, w := range windows {
-		if (w.StartTime == nil || ts.After(*w.StartTime)) && (w.EndTime == nil || !ts.After(*w.EndTime)) {
-			return true
+		if w.SLOSelector.Matches(labels) {
+			matching = append(matching, w)
 		}
 	}
-	return false
+	return matching
 }
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"slices"
 	"strconv"
 	"strings"
@@ -20,6 +22,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/vshn/vshn-sli-reporting/pkg/api/handler"
 	"github.com/vshn/vshn-sli-reporting/pkg/store/mock"
 	"github.com/vshn/vshn-sli-reporting/pkg/types"
 )
@@ -30,7 +33,7 @@ func setup(rv []types.DowntimeWindow, q, qr staticPrometheusQuerierResponse) (*h
 	}
 	mux := http.NewServeMux()
 
-	Setup(mux, store, staticPrometheusQuerier{queryRangeResponse: qr, queryResponse: q})
+	Setup(mux, store, staticPrometheusQuerier{queryRangeResponse: qr, queryResponse: q}, staticClusterLister{}, Config{})
 	return mux, store
 }
 
@@ -138,13 +141,1133 @@ func TestQueryWithDowntime(t *testing.T) {
 	assert.Equal(t, 1.0, serviceNanDowntime.ErrorBudgetRemainingWindowPercentage)
 }
 
+func TestQueryWithSLOSelector(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-02T00:00:00Z")
+
+	mux, _ := setup(
+		[]types.DowntimeWindow{
+			{
+				Title:       "Database maintenance",
+				StartTime:   ptrTo(from.Add(6 * time.Hour)),
+				EndTime:     ptrTo(from.Add(12 * time.Hour)),
+				SLOSelector: types.SLOSelector{"sloth_service": {Op: types.MatchRegexp, Value: "postgres|mysql"}},
+			},
+			{
+				Title:       "Ingress certificate rotation",
+				StartTime:   ptrTo(from.Add(18 * time.Hour)),
+				EndTime:     ptrTo(from.Add(20 * time.Hour)),
+				SLOSelector: types.SLOSelector{"sloth_slo": {Value: "ingress-availability"}},
+			},
+		}, staticPrometheusQuerierResponse{
+			value: model.Vector{},
+		}, staticPrometheusQuerierResponse{
+			value: promMatrix(
+				promSampleStream(t, model.Metric{
+					"__name__":      "slo:sli_error:ratio_rate1h",
+					"sloth_id":      "postgres-requests",
+					"sloth_service": "postgres",
+					"sloth_slo":     "requests",
+				}, from, "24x1"),
+				promSampleStream(t, model.Metric{
+					"__name__":      "slo:sli_error:ratio_rate1h",
+					"sloth_id":      "ingress-availability",
+					"sloth_service": "ingress",
+					"sloth_slo":     "ingress-availability",
+				}, from, "24x1"),
+			),
+		})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+
+	assert.Equal(t, explodeValues(t, "6x1 6x0 12x1"), collectErrorRate(queryResponse.SLIData["postgres-requests"].DataPoints))
+	assert.Equal(t, explodeValues(t, "18x1 2x0 4x1"), collectErrorRate(queryResponse.SLIData["ingress-availability"].DataPoints))
+}
+
+func TestQueryWithPartialDowntime(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	mux, _ := setup(
+		[]types.DowntimeWindow{
+			{
+				Title:     "10 minutes covering the sample",
+				StartTime: ptrTo(from.Add(55 * time.Minute)),
+				EndTime:   ptrTo(from.Add(65 * time.Minute)),
+			},
+			{
+				Title:     "50 minutes before the sample",
+				StartTime: ptrTo(from.Add(70 * time.Minute)),
+				EndTime:   ptrTo(from.Add(119 * time.Minute)),
+			},
+			{
+				Title:     "overlapping",
+				StartTime: ptrTo(from.Add(150 * time.Minute)),
+				EndTime:   ptrTo(from.Add(170 * time.Minute)),
+			},
+			{
+				Title:     "overlapping",
+				StartTime: ptrTo(from.Add(160 * time.Minute)),
+				EndTime:   ptrTo(from.Add(180 * time.Minute)),
+			},
+		}, staticPrometheusQuerierResponse{
+			value: model.Vector{},
+		}, staticPrometheusQuerierResponse{
+			value: promMatrix(
+				promSampleStream(t, sloErrorMetric("full"), from, "4x0.6"),
+			),
+		})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+
+	dps := queryResponse.SLIData["full"].DataPoints
+	require.Equal(t, 4, len(dps))
+	excluded := []float64{5.0 / 60, (5.0 + 49.0) / 60, 30.0 / 60, 0}
+	for i, dp := range dps {
+		assert.InDelta(t, excluded[i], dp.ExcludedFraction, 1e-9, "data point %d", i)
+		assert.InDelta(t, 0.6*(1-excluded[i]), dp.ErrorRate1h, 1e-9, "data point %d", i)
+		assert.Equal(t, 0.6, dp.RealErrorRate1h)
+	}
+}
+
+func TestQueryWithStep(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T01:00:00Z")
+
+	store := &mock.MockDowntimeStore{
+		ReturnValues: []types.DowntimeWindow{
+			{
+				Title:     "Test1",
+				StartTime: ptrTo(from.Add(10 * time.Minute)),
+				EndTime:   ptrTo(from.Add(22 * time.Minute)),
+			},
+		},
+	}
+	prom := &recordingPrometheusQuerier{staticPrometheusQuerier: staticPrometheusQuerier{
+		queryResponse: staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{
+				Metric: model.Metric{"__name__": "slo:objective:ratio", "sloth_id": "full"},
+				Value:  0.98,
+			},
+		}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStreamWithStep(t, sloErrorMetric("full"), from, 5*time.Minute, "12x1"),
+		)},
+	}}
+	mux := http.NewServeMux()
+	Setup(mux, store, prom, staticClusterLister{}, Config{})
+
+	req := httptest.
+		NewRequest(http.MethodGet, "/query/cluster/blub?from=2020-01-01T00:03:00Z&to=2020-01-01T01:04:59Z&step=5m", nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	require.Equal(t, 2, len(prom.rangeQueries))
+	assert.Contains(t, prom.rangeQueries[0], "slo:sli_error:ratio_rate5m")
+	for _, r := range prom.ranges {
+		assert.Equal(t, prometheusv1.Range{Start: from, End: to, Step: 5 * time.Minute}, r)
+	}
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, "5m", queryResponse.Step)
+
+	d := queryResponse.SLIData["full"]
+	rates := explodeValues(t, "2x1 0 0 0.6 7x1")
+	assert.Equal(t, rates[2:5], collectErrorRate(d.DataPoints)[2:5])
+	for i, v := range calculateAverages(rates, 12) {
+		assert.InDelta(t, v, d.DataPoints[i].CumulativeAverageErrorRate, 1e-9)
+	}
+	assert.InDelta(t, 9.6/12, d.ErrorRateWindow, 1e-9)
+}
+
+func TestQueryWithCustomNames(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	store := &mock.MockDowntimeStore{
+		ReturnValues: []types.DowntimeWindow{
+			{
+				Title:       "Test1",
+				StartTime:   ptrTo(from),
+				EndTime:     ptrTo(from.Add(time.Hour)),
+				SLOSelector: types.SLOSelector{"sloth_service": {Value: "ingress"}},
+			},
+		},
+	}
+	prom := &recordingPrometheusQuerier{staticPrometheusQuerier: staticPrometheusQuerier{
+		queryResponse: staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{
+				Metric: model.Metric{"__name__": "team:slo:objective:ratio", "slo": "ingress-requests"},
+				Value:  0.99,
+			},
+		}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, model.Metric{
+				"__name__": "team:slo:sli_error:ratio_rate1h",
+				"slo":      "ingress-requests",
+				"service":  "ingress",
+			}, from, "4x1"),
+		)},
+	}}
+	mux := http.NewServeMux()
+	Setup(mux, store, prom, staticClusterLister{}, Config{
+		ErrorRatioMetricPrefix: "team:slo:sli_error:ratio_rate",
+		ObjectiveMetric:        "team:slo:objective:ratio",
+		ClusterLabel:           "cluster",
+		SlothIDLabel:           "slo",
+		SlothServiceLabel:      "service",
+	})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	require.Equal(t, 2, len(prom.rangeQueries))
+	assert.Equal(t, `team:slo:sli_error:ratio_rate1h{cluster="blub",slo=~".*"}`, prom.rangeQueries[0])
+	assert.Equal(t, `team:slo:objective:ratio{cluster="blub",slo=~".*"}`, prom.rangeQueries[1])
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	d, ok := queryResponse.SLIData["ingress-requests"]
+	require.True(t, ok)
+	assert.Equal(t, 0.99, d.Objective)
+	assert.Equal(t, explodeValues(t, "0 3x1"), collectErrorRate(d.DataPoints))
+}
+
+func TestQueryWithObjectiveChange(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	objective := promSampleStream(t, model.Metric{"__name__": "slo:objective:ratio", "sloth_id": "full"}, from, "2x0.995 2x0.999")
+	mux, _ := setup(nil,
+		staticPrometheusQuerierResponse{
+			value: promMatrix(objective),
+		}, staticPrometheusQuerierResponse{
+			value: promMatrix(
+				promSampleStream(t, sloErrorMetric("full"), from, "4x0.001"),
+			),
+		})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+
+	d := queryResponse.SLIData["full"]
+	assert.Equal(t, 0.999, d.Objective)
+	assert.Equal(t, []ObjectiveChange{
+		{Timestamp: from.Add(3 * time.Hour), Previous: 0.995, Objective: 0.999},
+	}, d.ObjectiveChanges)
+
+	objectives := []float64{0.995, 0.995, 0.999, 0.999}
+	for i, dp := range d.DataPoints {
+		assert.Equal(t, objectives[i], dp.Objective)
+		assert.InDelta(t, 1-objectives[i]-0.001, dp.ErrorBudgetRemaining, 1e-9)
+	}
+	// budget is (2*0.005 + 2*0.001) / 4 = 0.003
+	assert.InDelta(t, 0.001, d.ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0.002, d.ErrorBudgetRemainingWindow, 1e-9)
+	assert.InDelta(t, 0.002/0.003, d.ErrorBudgetRemainingWindowPercentage, 1e-9)
+}
+
+func TestQueryWithMultipleObjectiveSeries(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	// the rule changed its labels, the new series is returned first and overlaps the old one at 2h
+	newObjective := promSampleStream(t, model.Metric{"__name__": "slo:objective:ratio", "sloth_id": "full", "sloth_version": "2"}, from.Add(time.Hour), "3x0.999")
+	oldObjective := promSampleStream(t, model.Metric{"__name__": "slo:objective:ratio", "sloth_id": "full", "sloth_version": "1"}, from, "2x0.995")
+	mux, _ := setup(nil,
+		staticPrometheusQuerierResponse{
+			value: promMatrix(newObjective, oldObjective),
+		}, staticPrometheusQuerierResponse{
+			value: promMatrix(
+				promSampleStream(t, sloErrorMetric("full"), from, "4x0.001"),
+			),
+		})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+
+	d := queryResponse.SLIData["full"]
+	assert.Equal(t, 0.999, d.Objective)
+	assert.Equal(t, []ObjectiveChange{
+		{Timestamp: from.Add(2 * time.Hour), Previous: 0.995, Objective: 0.999},
+	}, d.ObjectiveChanges)
+	assert.Equal(t, []float64{0.995, 0.999, 0.999, 0.999}, collectObjectives(d.DataPoints))
+}
+
+func TestObjectiveSeriesAt(t *testing.T) {
+	ts := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	o := newObjectiveSeries(map[model.Time]model.SampleValue{
+		model.TimeFromUnixNano(ts.Add(2 * time.Hour).UnixNano()): 0.99,
+		model.TimeFromUnixNano(ts.Add(time.Hour).UnixNano()):     0.9,
+	})
+	assert.Equal(t, 0.9, o.at(ts), "before the first sample")
+	assert.Equal(t, 0.9, o.at(ts.Add(time.Hour)))
+	assert.Equal(t, 0.9, o.at(ts.Add(90*time.Minute)))
+	assert.Equal(t, 0.99, o.at(ts.Add(2*time.Hour)))
+	assert.Equal(t, 0.99, o.at(ts.Add(48*time.Hour)))
+}
+
+func TestQueryMissingData(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T10:00:00Z")
+
+	// 10 hours: 4 samples with 0.5 errors, 2 NaN samples and 4 hours without samples
+	mux, _ := setup(nil,
+		staticPrometheusQuerierResponse{
+			value: model.Vector{
+				&model.Sample{
+					Metric: model.Metric{"__name__": "slo:objective:ratio", "sloth_id": "full"},
+					Value:  0.9,
+				},
+			},
+		}, staticPrometheusQuerierResponse{
+			value: promMatrix(
+				promSampleStream(t, sloErrorMetric("full"), from, "4x0.5 2xNaN"),
+			),
+		})
+
+	query := func(policy string) QueryClusterResponseSLIData {
+		t.Helper()
+		req := httptest.
+			NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s&missing_data=%s", from.Format(time.RFC3339), to.Format(time.RFC3339), policy), nil).
+			WithContext(logr.NewContext(t.Context(), testr.New(t)))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		require.Equal(t, "200 OK", res.Status)
+
+		var queryResponse QueryClusterResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+		return queryResponse.SLIData["full"]
+	}
+
+	good := query("")
+	assert.Equal(t, 6.0, good.MissingHours)
+	assert.Equal(t, explodeValues(t, "4x0.5 2x0"), collectErrorRate(good.DataPoints))
+	assert.Equal(t, []bool{false, false, false, false, true, true}, collectMissing(good.DataPoints))
+	assert.InDelta(t, 0.2, good.ErrorRateWindow, 1e-9)
+	assert.Equal(t, good, query("good"))
+
+	bad := query("bad")
+	assert.Equal(t, 6.0, bad.MissingHours)
+	assert.Equal(t, explodeValues(t, "4x0.5 2x1"), collectErrorRate(bad.DataPoints))
+	assert.InDelta(t, 0.8, bad.ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0.4, bad.DataPoints[5].CumulativeAverageErrorRate, 1e-9)
+	assert.InDelta(t, 0.1-0.8, bad.ErrorBudgetRemainingWindow, 1e-9)
+
+	exclude := query("exclude")
+	assert.Equal(t, 6.0, exclude.MissingHours)
+	assert.Equal(t, explodeValues(t, "4x0.5 2x0"), collectErrorRate(exclude.DataPoints))
+	assert.InDelta(t, 0.5, exclude.ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0.5, exclude.DataPoints[5].CumulativeAverageErrorRate, 1e-9)
+	assert.InDelta(t, 0.1-0.5, exclude.ErrorBudgetRemainingWindow, 1e-9)
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s&missing_data=unknown", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestQueryWeightedByRequests(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	store := &mock.MockDowntimeStore{
+		ReturnValues: []types.DowntimeWindow{
+			{
+				Title:     "Test1",
+				StartTime: ptrTo(from.Add(time.Hour)),
+				EndTime:   ptrTo(from.Add(2 * time.Hour)),
+			},
+		},
+	}
+	prom := &recordingPrometheusQuerier{staticPrometheusQuerier: staticPrometheusQuerier{
+		queryResponse: staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{
+				Metric: model.Metric{"__name__": "slo:objective:ratio", "sloth_id": "full"},
+				Value:  0.9,
+			},
+		}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, sloErrorMetric("full"), from, "2x0.1 0.5 0"),
+		)},
+		eventsResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, model.Metric{"sloth_id": "full"}, from, "2x1000 100 1000"),
+		)},
+	}}
+	mux := http.NewServeMux()
+	Setup(mux, store, prom, staticClusterLister{}, Config{EventsMetric: "slo:sli_events:total"})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s&weighting=requests", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	require.Equal(t, 3, len(prom.rangeQueries))
+	assert.Equal(t, `sum by (cluster_id, sloth_id) (increase(slo:sli_events:total{cluster_id="blub",sloth_id=~".*"}[1h]))`, prom.rangeQueries[2])
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, "requests", queryResponse.Weighting)
+
+	d := queryResponse.SLIData["full"]
+	// the second hour with 1000 events is excluded, leaving 100 + 50 error events out of 2100 events
+	assert.InDelta(t, 2100, d.TotalEvents, 1e-9)
+	assert.InDelta(t, 150, d.ErrorEvents, 1e-9)
+	assert.InDelta(t, 150.0/2100, d.ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0.1-150.0/2100, d.ErrorBudgetRemainingWindow, 1e-9)
+	assert.Equal(t, []float64{1000, 1000, 100, 1000}, []float64{d.DataPoints[0].TotalEvents, d.DataPoints[1].TotalEvents, d.DataPoints[2].TotalEvents, d.DataPoints[3].TotalEvents})
+	assert.InDelta(t, 150.0/2100, d.DataPoints[3].CumulativeAverageErrorRate, 1e-9)
+	assert.InDelta(t, 250.0/3100, d.DataPoints[3].CumulativeAverageRealErrorRate, 1e-9)
+	assert.InDelta(t, 100.0/2100, d.DataPoints[1].CumulativeAverageErrorRate, 1e-9)
+}
+
+func TestQueryWeightedByRequestsWithoutEvents(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	prom := staticPrometheusQuerier{
+		queryResponse: staticPrometheusQuerierResponse{value: model.Vector{}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, sloErrorMetric("full"), from, "4x0.5"),
+			promSampleStream(t, sloErrorMetric("other"), from, "4x0.5"),
+		)},
+		eventsResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, model.Metric{"sloth_id": "other"}, from, "4x1000"),
+		)},
+	}
+	target := "/query/cluster/blub?from=2020-01-01T00:00:00Z&to=2020-01-01T04:00:00Z&weighting=requests"
+
+	for name, config := range map[string]Config{
+		"default events metric": {},
+		"events metric":         {EventsMetric: "team:slo:events:total"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			Setup(mux, &mock.MockDowntimeStore{}, prom, staticClusterLister{}, config)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil).WithContext(logr.NewContext(t.Context(), testr.New(t))))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var queryResponse QueryClusterResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&queryResponse))
+			assert.Equal(t, weightingRequests, queryResponse.Weighting)
+
+			// the SLO without events falls back to the hours weighting
+			full := queryResponse.SLIData["full"]
+			require.Len(t, full.Warnings, 1)
+			assert.Contains(t, full.Warnings[0], "no "+config.withDefaults().EventsMetric+" series found")
+			assert.InDelta(t, 0.5, full.ErrorRateWindow, 1e-9)
+			assert.Zero(t, full.TotalEvents)
+
+			other := queryResponse.SLIData["other"]
+			assert.Empty(t, other.Warnings)
+			assert.InDelta(t, 0.5, other.ErrorRateWindow, 1e-9)
+			assert.InDelta(t, 4000, other.TotalEvents, 1e-9)
+		})
+	}
+}
+
+func TestQueryInvalidStep(t *testing.T) {
+	mux, _ := setup(nil, staticPrometheusQuerierResponse{value: model.Vector{}}, staticPrometheusQuerierResponse{value: model.Matrix{}})
+
+	req := httptest.NewRequest(http.MethodGet, "/query/cluster/blub?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z&step=7m", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/query/cluster/blub?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z&step=3d", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), "at least one step")
+}
+
+func TestQueryMultiDayStepAlignedToFrom(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-02T00:00:00Z")
+	mux, _ := setup(nil, staticPrometheusQuerierResponse{value: model.Vector{}}, staticPrometheusQuerierResponse{value: promMatrix(
+		promSampleStreamWithStep(t, sloErrorMetric("full"), from, 72*time.Hour, "0.1 0.2"),
+	)})
+
+	req := httptest.
+		NewRequest(http.MethodGet, "/query/cluster/blub?from=2020-01-02T10:00:00Z&to=2020-01-08T00:00:00Z&step=3d", nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, from, queryResponse.From.UTC())
+	require.Equal(t, 2, len(queryResponse.SLIData["full"].DataPoints))
+	assert.Equal(t, from.Add(72*time.Hour), queryResponse.SLIData["full"].DataPoints[0].Timestamp.UTC())
+	assert.InDelta(t, 0.15, queryResponse.SLIData["full"].ErrorRateWindow, 1e-9)
+}
+
+func TestQueryDowntimeAttribution(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	mux, _ := setup(
+		[]types.DowntimeWindow{
+			{
+				ID:           "a",
+				Title:        "Test1",
+				ExternalLink: "https://example.com/a",
+				StartTime:    ptrTo(from),
+				EndTime:      ptrTo(from.Add(90 * time.Minute)),
+			},
+			{
+				ID:        "b",
+				Title:     "Test2",
+				StartTime: ptrTo(from.Add(time.Hour)),
+				EndTime:   ptrTo(from.Add(2 * time.Hour)),
+			},
+			{
+				ID:          "c",
+				Title:       "Other SLO",
+				StartTime:   ptrTo(from),
+				EndTime:     ptrTo(to),
+				SLOSelector: types.SLOSelector{"sloth_id": {Value: "other"}},
+			},
+		},
+		staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{Metric: model.Metric{"sloth_id": "full"}, Value: 0.9},
+		}},
+		staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, sloErrorMetric("full"), from, "4x0.2"),
+		)},
+	)
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/cluster/blub?from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, 3, len(queryResponse.Downtimes))
+
+	d := queryResponse.SLIData["full"]
+	require.Equal(t, 2, len(d.DowntimeAttribution))
+	a, b := d.DowntimeAttribution[0], d.DowntimeAttribution[1]
+	assert.Equal(t, "a", a.WindowID)
+	assert.Equal(t, "Test1", a.Title)
+	assert.Equal(t, "https://example.com/a", a.ExternalLink)
+	// the overlap from 01:00 to 01:30 is split between both windows
+	assert.InDelta(t, 1.25, a.HoursExcluded, 1e-9)
+	assert.InDelta(t, 0.2*1.25/4, a.ErrorBudgetRecovered, 1e-9)
+	assert.Equal(t, "b", b.WindowID)
+	assert.InDelta(t, 0.75, b.HoursExcluded, 1e-9)
+	assert.InDelta(t, 0.2*0.75/4, b.ErrorBudgetRecovered, 1e-9)
+	assert.InDelta(t, d.DataPoints[3].CumulativeAverageRealErrorRate-d.ErrorRateWindow, a.ErrorBudgetRecovered+b.ErrorBudgetRecovered, 1e-9)
+
+	assert.Equal(t, []string{"a"}, d.DataPoints[0].DowntimeIDs)
+	assert.Equal(t, []string{"a", "b"}, d.DataPoints[1].DowntimeIDs)
+	assert.Empty(t, d.DataPoints[2].DowntimeIDs)
+}
+
+func TestExcludedByWindow(t *testing.T) {
+	ts := mustTimeFromRFC3339(t, "2020-01-01T01:00:00Z")
+	at := func(m int) *time.Time {
+		return ptrTo(ts.Add(time.Duration(m) * time.Minute))
+	}
+	windows := []types.DowntimeWindow{
+		{ID: "a", StartTime: at(-60), EndTime: at(-30)},
+		{ID: "b", StartTime: at(-45), EndTime: at(-15)},
+		{ID: "c", StartTime: at(-40), EndTime: at(-35)},
+		{ID: "d", StartTime: at(-120), EndTime: at(-60)},
+	}
+	fractions := excludedByWindow(ts, time.Hour, windows)
+	assert.Equal(t, 3, len(fractions))
+	assert.InDelta(t, (15+5.0/3+10.0/2)/60, fractions["a"], 1e-9)
+	assert.InDelta(t, (5.0/3+10.0/2+15)/60, fractions["b"], 1e-9)
+	assert.InDelta(t, 5.0/3/60, fractions["c"], 1e-9)
+
+	var sum float64
+	for _, f := range fractions {
+		sum += f
+	}
+	assert.InDelta(t, excludedFraction(ts, time.Hour, windows), sum, 1e-9)
+}
+
+func TestExcludedFraction(t *testing.T) {
+	ts := mustTimeFromRFC3339(t, "2020-01-01T01:00:00Z")
+	at := func(m int) *time.Time {
+		return ptrTo(ts.Add(time.Duration(m) * time.Minute))
+	}
+	tcs := map[string]struct {
+		windows  []types.DowntimeWindow
+		expected float64
+	}{
+		"no windows":           {nil, 0},
+		"whole hour":           {[]types.DowntimeWindow{{StartTime: at(-60), EndTime: at(0)}}, 1},
+		"open ended":           {[]types.DowntimeWindow{{StartTime: at(-30)}}, 0.5},
+		"no start":             {[]types.DowntimeWindow{{EndTime: at(-45)}}, 0.25},
+		"ends at bucket start": {[]types.DowntimeWindow{{StartTime: at(-120), EndTime: at(-60)}}, 0},
+		"starts at sample":     {[]types.DowntimeWindow{{StartTime: at(0), EndTime: at(60)}}, 0},
+		"longer than bucket":   {[]types.DowntimeWindow{{StartTime: at(-90), EndTime: at(30)}}, 1},
+		"disjoint": {[]types.DowntimeWindow{
+			{StartTime: at(-50), EndTime: at(-40)},
+			{StartTime: at(-20), EndTime: at(-5)},
+		}, 25.0 / 60},
+		"overlapping": {[]types.DowntimeWindow{
+			{StartTime: at(-20), EndTime: at(-5)},
+			{StartTime: at(-50), EndTime: at(-10)},
+			{StartTime: at(-45), EndTime: at(-30)},
+		}, 45.0 / 60},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			assert.InDelta(t, tc.expected, excludedFraction(ts, time.Hour, tc.windows), 1e-9)
+		})
+	}
+}
+
+func TestQueryAsOf(t *testing.T) {
+	mux, store := setup(nil, staticPrometheusQuerierResponse{value: model.Vector{}}, staticPrometheusQuerierResponse{value: model.Matrix{}})
+
+	req := httptest.
+		NewRequest(http.MethodGet, "/query/cluster/blub?from=2020-01-01T00:00:00Z&to=2020-02-01T00:00:00Z&as_of=2020-03-01T00:00:00Z", nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	require.Equal(t, "200 OK", res.Status)
+	assert.Equal(t, "listclusterasof", store.LastCall)
+	assert.Equal(t, "blub", store.LastCallCluster)
+	assert.True(t, mustTimeFromRFC3339(t, "2020-03-01T00:00:00Z").Equal(store.LastCallAsOf))
+}
+
+func TestQueryClusters(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	lister := clusterDowntimeLister{
+		"c-a": {{Title: "Test1", StartTime: ptrTo(from), EndTime: ptrTo(from.Add(time.Hour))}},
+	}
+	prom := &recordingPrometheusQuerier{staticPrometheusQuerier: staticPrometheusQuerier{
+		queryResponse: staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{Metric: model.Metric{"cluster_id": "c-a", "sloth_id": "full"}, Value: 0.9},
+			&model.Sample{Metric: model.Metric{"cluster_id": "c-b", "sloth_id": "full"}, Value: 0.9},
+		}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, model.Metric{"cluster_id": "c-a", "sloth_id": "full"}, from, "0.2 3x0"),
+			promSampleStream(t, model.Metric{"cluster_id": "c-b", "sloth_id": "full"}, from, "0.2 3x0"),
+		)},
+	}}
+	mux := http.NewServeMux()
+	Setup(mux, lister, prom, staticClusterLister{"": {"c-a", "c-b", "c-c"}}, Config{})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query?cluster=c-b&cluster=c-a&cluster=c-b&from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	require.Equal(t, 2, len(prom.rangeQueries))
+	assert.Equal(t, `slo:sli_error:ratio_rate1h{cluster_id=~"c-a|c-b",sloth_id=~".*"}`, prom.rangeQueries[0])
+
+	var queryResponse QueryFleetResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Empty(t, queryResponse.Tenant)
+	require.Equal(t, 2, len(queryResponse.Clusters))
+
+	// the downtime only applies to c-a
+	a := queryResponse.Clusters["c-a"]
+	assert.Equal(t, "c-a", a.ClusterID)
+	assert.InDelta(t, 0, a.SLIData["full"].ErrorRateWindow, 1e-9)
+	b := queryResponse.Clusters["c-b"]
+	assert.Equal(t, "c-b", b.ClusterID)
+	assert.InDelta(t, 0.05, b.SLIData["full"].ErrorRateWindow, 1e-9)
+
+	f := queryResponse.Fleet["full"]
+	assert.Equal(t, 2, f.Clusters)
+	assert.InDelta(t, 0.025, f.ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0.075, f.ErrorBudgetRemainingWindow, 1e-9)
+	assert.InDelta(t, 0.75, f.ErrorBudgetRemainingWindowPercentage, 1e-9)
+}
+
+func TestQueryClustersRequiresCluster(t *testing.T) {
+	mux, _ := setup(nil, staticPrometheusQuerierResponse{value: model.Vector{}}, staticPrometheusQuerierResponse{value: model.Matrix{}})
+
+	req := httptest.NewRequest(http.MethodGet, "/query?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestQueryClustersUnknownCluster(t *testing.T) {
+	prom := &recordingPrometheusQuerier{staticPrometheusQuerier: staticPrometheusQuerier{
+		queryResponse:      staticPrometheusQuerierResponse{value: model.Vector{}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: model.Matrix{}},
+	}}
+	mux := http.NewServeMux()
+	Setup(mux, &mock.MockDowntimeStore{}, prom, staticClusterLister{"": {"c-a", "c-b"}}, Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/query?cluster=c-a&cluster=c-typo&cluster=c-nope&from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown clusters: c-nope, c-typo")
+	assert.Empty(t, prom.rangeQueries, "unknown clusters are rejected before querying Prometheus")
+}
+
+func TestQueryTenant(t *testing.T) {
+	store := &mock.MockDowntimeStore{}
+	prom := &recordingPrometheusQuerier{staticPrometheusQuerier: staticPrometheusQuerier{
+		queryResponse:      staticPrometheusQuerierResponse{value: model.Vector{}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: model.Matrix{}},
+	}}
+	mux := http.NewServeMux()
+	Setup(mux, store, prom, staticClusterLister{"t-acme": {"c-a", "c-b.x"}}, Config{})
+
+	req := httptest.
+		NewRequest(http.MethodGet, "/query/tenant/t-acme?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z", nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+	assert.Equal(t, `slo:sli_error:ratio_rate1h{cluster_id=~"c-a|c-b\\.x",sloth_id=~".*"}`, prom.rangeQueries[0])
+
+	var queryResponse QueryFleetResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, "t-acme", queryResponse.Tenant)
+	assert.ElementsMatch(t, []string{"c-a", "c-b.x"}, slices.Collect(maps.Keys(queryResponse.Clusters)))
+
+	req = httptest.NewRequest(http.MethodGet, "/query/tenant/t-unknown?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestQuerySLO(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	lister := clusterDowntimeLister{
+		"c-a": {{Title: "Test1", StartTime: ptrTo(from), EndTime: ptrTo(from.Add(time.Hour))}},
+	}
+	prom := &recordingPrometheusQuerier{staticPrometheusQuerier: staticPrometheusQuerier{
+		queryResponse: staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{Metric: model.Metric{"cluster_id": "c-a", "sloth_id": "ingress"}, Value: 0.9},
+			&model.Sample{Metric: model.Metric{"cluster_id": "c-b", "sloth_id": "ingress"}, Value: 0.9},
+			&model.Sample{Metric: model.Metric{"cluster_id": "c-c", "sloth_id": "ingress"}, Value: 0.9},
+		}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, model.Metric{"cluster_id": "c-a", "sloth_id": "ingress"}, from, "0.2 3x0"),
+			promSampleStream(t, model.Metric{"cluster_id": "c-b", "sloth_id": "ingress"}, from, "0.2 3x0"),
+			promSampleStream(t, model.Metric{"cluster_id": "c-c", "sloth_id": "ingress"}, from, "0.2 0.2 2x0"),
+		)},
+	}}
+	mux := http.NewServeMux()
+	Setup(mux, lister, prom, staticClusterLister{}, Config{})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/slo/ingress?from=%s&to=%s&filter=other", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	require.Equal(t, 2, len(prom.rangeQueries))
+	assert.Equal(t, `slo:sli_error:ratio_rate1h{cluster_id!="",sloth_id=~"ingress"}`, prom.rangeQueries[0])
+
+	var queryResponse QuerySLOResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, "ingress", queryResponse.SlothID)
+	require.Equal(t, 3, len(queryResponse.Clusters))
+
+	// c-a has the most budget left since its downtime excludes the errors
+	assert.Equal(t, []string{"c-c", "c-b", "c-a"}, []string{queryResponse.Clusters[0].ClusterID, queryResponse.Clusters[1].ClusterID, queryResponse.Clusters[2].ClusterID})
+	assert.InDelta(t, 0.1, queryResponse.Clusters[0].ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0.05, queryResponse.Clusters[1].ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0, queryResponse.Clusters[2].ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 1, queryResponse.Clusters[2].ErrorBudgetRemainingWindowPercentage, 1e-9)
+}
+
+func TestQuerySLOUnknownCluster(t *testing.T) {
+	from := mustTimeFromRFC3339(t, "2020-01-01T00:00:00Z")
+	to := mustTimeFromRFC3339(t, "2020-01-01T04:00:00Z")
+
+	lister := knownClustersLister{
+		clusterDowntimeLister: clusterDowntimeLister{
+			"c-a": {{Title: "Test1", StartTime: ptrTo(from), EndTime: ptrTo(from.Add(time.Hour))}},
+		},
+		known: []string{"c-a"},
+	}
+	prom := &recordingPrometheusQuerier{staticPrometheusQuerier: staticPrometheusQuerier{
+		queryResponse: staticPrometheusQuerierResponse{value: model.Vector{
+			&model.Sample{Metric: model.Metric{"cluster_id": "c-a", "sloth_id": "ingress"}, Value: 0.9},
+			&model.Sample{Metric: model.Metric{"cluster_id": "c-gone", "sloth_id": "ingress"}, Value: 0.9},
+		}},
+		queryRangeResponse: staticPrometheusQuerierResponse{value: promMatrix(
+			promSampleStream(t, model.Metric{"cluster_id": "c-a", "sloth_id": "ingress"}, from, "0.2 3x0"),
+			promSampleStream(t, model.Metric{"cluster_id": "c-gone", "sloth_id": "ingress"}, from, "0.2 3x0"),
+			promSampleStream(t, model.Metric{"sloth_id": "ingress"}, from, "4x1"),
+		)},
+	}}
+	mux := http.NewServeMux()
+	Setup(mux, lister, prom, staticClusterLister{}, Config{})
+
+	req := httptest.
+		NewRequest(http.MethodGet, fmt.Sprintf("/query/slo/ingress?from=%s&to=%s", from.Format(time.RFC3339), to.Format(time.RFC3339)), nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QuerySLOResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	// the series without cluster label is skipped, the unknown cluster is ranked without downtimes
+	require.Equal(t, 2, len(queryResponse.Clusters))
+	assert.Equal(t, "c-gone", queryResponse.Clusters[0].ClusterID)
+	assert.InDelta(t, 0.05, queryResponse.Clusters[0].ErrorRateWindow, 1e-9)
+	assert.Equal(t, []string{"could not list the downtimes of the cluster, no downtime is excluded"}, queryResponse.Clusters[0].Warnings)
+	assert.Equal(t, "c-a", queryResponse.Clusters[1].ClusterID)
+	assert.InDelta(t, 0, queryResponse.Clusters[1].ErrorRateWindow, 1e-9)
+	assert.Empty(t, queryResponse.Clusters[1].Warnings)
+}
+
+func TestAggregateFleet(t *testing.T) {
+	responses := map[string]QueryClusterResponse{
+		"c-a": {SLIData: map[string]QueryClusterResponseSLIData{
+			"full": {Objective: 0.9, ErrorRateWindow: 0.1, ErrorBudgetRemainingWindow: 0, TotalEvents: 3000, ErrorEvents: 300},
+		}},
+		"c-b": {SLIData: map[string]QueryClusterResponseSLIData{
+			"full":  {Objective: 0.9, ErrorRateWindow: 0.02, ErrorBudgetRemainingWindow: 0.08, TotalEvents: 1000, ErrorEvents: 20},
+			"other": {ErrorRateWindow: 0.5, Warnings: []string{"no events"}},
+		}},
+	}
+
+	fleet := aggregateFleet(responses, weightingHours)
+	assert.Equal(t, 2, fleet["full"].Clusters)
+	assert.InDelta(t, 0.06, fleet["full"].ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0.04, fleet["full"].ErrorBudgetRemainingWindow, 1e-9)
+	assert.InDelta(t, 0.4, fleet["full"].ErrorBudgetRemainingWindowPercentage, 1e-9)
+	assert.Zero(t, fleet["full"].TotalEvents)
+	assert.Equal(t, 1, fleet["other"].Clusters)
+	assert.InDelta(t, 0.5, fleet["other"].ErrorRateWindow, 1e-9)
+	assert.Zero(t, fleet["other"].ErrorBudgetRemainingWindow)
+	assert.Equal(t, []string{"cluster c-b: no events"}, fleet["other"].Warnings)
+	assert.Empty(t, fleet["full"].Warnings)
+
+	fleet = aggregateFleet(responses, weightingRequests)
+	assert.InDelta(t, 320.0/4000, fleet["full"].ErrorRateWindow, 1e-9)
+	assert.InDelta(t, 0.1-320.0/4000, fleet["full"].ErrorBudgetRemainingWindow, 1e-9)
+	assert.InDelta(t, 4000, fleet["full"].TotalEvents, 1e-9)
+	assert.InDelta(t, 320, fleet["full"].ErrorEvents, 1e-9)
+}
+
+func TestResolvePeriod(t *testing.T) {
+	zurich, err := time.LoadLocation("Europe/Zurich")
+	require.NoError(t, err)
+	now := mustTimeFromRFC3339(t, "2026-03-30T10:00:00Z").In(zurich)
+
+	tcs := map[string]struct {
+		period   string
+		now      time.Time
+		from, to string
+	}{
+		"month utc":          {"2026-09", now.UTC(), "2026-09-01T00:00:00Z", "2026-10-01T00:00:00Z"},
+		"month ending dst":   {"2026-10", now, "2026-09-30T22:00:00Z", "2026-10-31T23:00:00Z"},
+		"quarter":            {"2026-Q3", now, "2026-06-30T22:00:00Z", "2026-09-30T22:00:00Z"},
+		"quarter across dst": {"2026-Q1", now, "2025-12-31T23:00:00Z", "2026-03-31T22:00:00Z"},
+		"last days":          {"last-30d", now, "2026-02-27T23:00:00Z", "2026-03-29T22:00:00Z"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			from, to, err := resolvePeriod(tc.period, tc.now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.from, from.UTC().Format(time.RFC3339))
+			assert.Equal(t, tc.to, to.UTC().Format(time.RFC3339))
+			assert.Equal(t, tc.now.Location(), from.Location())
+		})
+	}
+
+	for _, period := range []string{"2026-13", "2026-Q5", "last-0d", "last-month", "2026"} {
+		_, _, err := resolvePeriod(period, now)
+		assert.Error(t, err, period)
+	}
+}
+
+func TestTruncateInLocation(t *testing.T) {
+	ts := mustTimeFromRFC3339(t, "2026-09-01T00:10:00+05:30")
+	assert.Equal(t, "2026-09-01T00:00:00+05:30", truncateInLocation(ts, time.Hour).Format(time.RFC3339))
+	assert.Equal(t, "2026-09-01T00:00:00+05:30", truncateInLocation(ts, 24*time.Hour).Format(time.RFC3339))
+	assert.Equal(t, "2026-09-01T00:00:00+05:30", truncateInLocation(ts.Add(50*time.Minute), 2*time.Hour).Format(time.RFC3339))
+}
+
+func TestQueryWithPeriod(t *testing.T) {
+	mux, _ := setup(nil, staticPrometheusQuerierResponse{value: model.Vector{}}, staticPrometheusQuerierResponse{value: promMatrix(
+		promSampleStream(t, sloErrorMetric("full"), mustTimeFromRFC3339(t, "2025-09-30T22:00:00Z"), "745x0"),
+	)})
+
+	req := httptest.
+		NewRequest(http.MethodGet, "/query/cluster/blub?period=2025-10&tz=Europe/Zurich", nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, "2025-10-01T00:00:00+02:00", queryResponse.From.Format(time.RFC3339))
+	assert.Equal(t, "2025-11-01T00:00:00+01:00", queryResponse.To.Format(time.RFC3339))
+	// October has an additional hour in Europe/Zurich
+	assert.Equal(t, 745, len(queryResponse.SLIData["full"].DataPoints))
+
+	for _, query := range []string{
+		"period=2026-10&from=2026-10-01T00:00:00Z",
+		"period=2026-13",
+		"period=2026-10&tz=Mars/Olympus",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/query/cluster/blub?"+query, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestParseQueryParamsDailyStepsAcrossDST(t *testing.T) {
+	now := mustTimeFromRFC3339(t, "2027-01-01T00:00:00Z")
+
+	// March has 743 and October 745 hours in Europe/Zurich, fixed steps would drop or misalign a step
+	for _, period := range []string{"2026-03", "2026-10"} {
+		for _, step := range []string{"3d", "6h", "2h"} {
+			_, err := parseQueryParams(url.Values{"period": {period}, "tz": {"Europe/Zurich"}, "step": {step}}, now)
+			require.Error(t, err, period, step)
+			var errWithCode handler.ErrWithCode
+			require.ErrorAs(t, err, &errWithCode)
+			assert.Equal(t, http.StatusBadRequest, errWithCode.Code)
+			assert.Contains(t, err.Error(), "is not a multiple of `step`")
+		}
+	}
+
+	tcs := map[string]struct {
+		period, step string
+		steps        int
+		promStep     time.Duration
+	}{
+		"march hourly":  {"2026-03", "1h", 743, time.Hour},
+		"march daily":   {"2026-03", "1d", 31, time.Hour},
+		"april daily":   {"2026-04", "1d", 30, 24 * time.Hour},
+		"october daily": {"2026-10", "1d", 31, time.Hour},
+		"october utc":   {"2026-10", "1d", 31, 24 * time.Hour},
+		"quarter daily": {"2026-Q3", "1d", 92, 24 * time.Hour},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			q := url.Values{"period": {tc.period}, "step": {tc.step}}
+			if name != "october utc" {
+				q.Set("tz", "Europe/Zurich")
+			}
+			p, err := parseQueryParams(q, now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.steps, len(p.ends))
+			assert.Equal(t, tc.promStep, p.promStep)
+			assert.True(t, p.to.Equal(p.ends[len(p.ends)-1]))
+			for i, end := range p.ends {
+				// the range queries have a sample at the end of every step
+				assert.Zero(t, end.Sub(p.from)%p.promStep)
+				if tc.step == "1d" {
+					assert.Equal(t, 0, end.In(p.from.Location()).Hour(), "daily steps end at midnight")
+					assert.True(t, end.Equal(p.from.AddDate(0, 0, i+1)), "one step per calendar day")
+				}
+			}
+		})
+	}
+}
+
+func TestQueryDailyStepsAcrossDST(t *testing.T) {
+	zurich, err := time.LoadLocation("Europe/Zurich")
+	require.NoError(t, err)
+	from := time.Date(2025, 10, 1, 0, 0, 0, 0, zurich)
+	values := make([]model.SamplePair, 0, 31)
+	for day := 1; day <= 31; day++ {
+		// no data for the day with the DST change
+		if day == 26 {
+			continue
+		}
+		values = append(values, model.SamplePair{Timestamp: model.TimeFromUnixNano(from.AddDate(0, 0, day).UnixNano()), Value: 0.1})
+	}
+	mux, _ := setup(nil, staticPrometheusQuerierResponse{value: model.Vector{}}, staticPrometheusQuerierResponse{value: promMatrix(
+		model.SampleStream{Metric: sloErrorMetric("full"), Values: values},
+	)})
+
+	req := httptest.
+		NewRequest(http.MethodGet, "/query/cluster/blub?period=2025-10&tz=Europe/Zurich&step=1d", nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, "2025-11-01T00:00:00+01:00", queryResponse.To.Format(time.RFC3339))
+	d := queryResponse.SLIData["full"]
+	require.Equal(t, 30, len(d.DataPoints))
+	for _, dp := range d.DataPoints {
+		assert.Equal(t, 0, dp.Timestamp.In(zurich).Hour(), "daily steps end at midnight")
+	}
+	// the missing day has 25 hours, it is weighted by its length
+	assert.Equal(t, 25.0, d.MissingHours)
+	assert.InDelta(t, 0.1*720/745, d.ErrorRateWindow, 1e-9)
+}
+
+func TestParseQueryParamsClampsToNow(t *testing.T) {
+	zurich, err := time.LoadLocation("Europe/Zurich")
+	require.NoError(t, err)
+	now := mustTimeFromRFC3339(t, "2026-10-16T17:30:00Z")
+
+	p, err := parseQueryParams(url.Values{"period": {"2026-10"}, "tz": {"Europe/Zurich"}}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10-16T19:00:00+02:00", p.to.In(zurich).Format(time.RFC3339))
+	assert.Equal(t, 15*24+19, len(p.ends))
+
+	p, err = parseQueryParams(url.Values{"period": {"2026-09"}, "tz": {"Europe/Zurich"}, "step": {"1d"}}, mustTimeFromRFC3339(t, "2026-09-16T10:00:00Z"))
+	require.NoError(t, err)
+	assert.Equal(t, "2026-09-16T00:00:00+02:00", p.to.In(zurich).Format(time.RFC3339))
+	assert.Equal(t, 15, len(p.ends))
+
+	// only the current period is clamped, an explicit window is kept and its future steps count as missing
+	p, err = parseQueryParams(url.Values{"from": {"2026-10-16T00:00:00Z"}, "to": {"2026-10-18T00:00:00Z"}}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10-18T00:00:00Z", p.to.UTC().Format(time.RFC3339))
+	assert.Equal(t, 48, len(p.ends))
+
+	_, err = parseQueryParams(url.Values{"period": {"2026-11"}, "tz": {"Europe/Zurich"}}, now)
+	assert.Error(t, err, "periods starting in the future have no completed step")
+}
+
+func TestQueryWithOffset(t *testing.T) {
+	mux, _ := setup(nil, staticPrometheusQuerierResponse{value: model.Vector{}}, staticPrometheusQuerierResponse{value: model.Matrix{}})
+
+	req := httptest.
+		NewRequest(http.MethodGet, "/query/cluster/blub?from=2026-09-01T00:00:00%2B05:30&to=2026-09-02T00:00:00%2B05:30", nil).
+		WithContext(logr.NewContext(t.Context(), testr.New(t)))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, "200 OK", res.Status)
+
+	var queryResponse QueryClusterResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&queryResponse))
+	assert.Equal(t, "2026-09-01T00:00:00+05:30", queryResponse.From.Format(time.RFC3339))
+	assert.Equal(t, "2026-09-02T00:00:00+05:30", queryResponse.To.Format(time.RFC3339))
+}
+
 func calculateComparisonAverages(rates []float64) []float64 {
-	hrs := 24 * 31 // hours in test timeframe
+	return calculateAverages(rates, 24*31) // hours in test timeframe
+}
+
+func calculateAverages(rates []float64, steps int) []float64 {
 	cum := 0.0
 	result := make([]float64, len(rates))
 	for i := range rates {
 		cum = cum + rates[i]
-		result[i] = cum / float64(hrs)
+		result[i] = cum / float64(steps)
 	}
 	return result
 }
@@ -156,6 +1279,20 @@ func collectErrorRate(dp []SLIDataPoint) []float64 {
 	}
 	return values
 }
+func collectObjectives(dp []SLIDataPoint) []float64 {
+	values := make([]float64, len(dp))
+	for i := range dp {
+		values[i] = dp[i].Objective
+	}
+	return values
+}
+func collectMissing(dp []SLIDataPoint) []bool {
+	values := make([]bool, len(dp))
+	for i := range dp {
+		values[i] = dp[i].Missing
+	}
+	return values
+}
 func collectRealErrorRate(dp []SLIDataPoint) []float64 {
 	values := make([]float64, len(dp))
 	for i := range dp {
@@ -186,16 +1323,80 @@ type staticPrometheusQuerierResponse struct {
 type staticPrometheusQuerier struct {
 	queryRangeResponse staticPrometheusQuerierResponse
 	queryResponse      staticPrometheusQuerierResponse
+	eventsResponse     staticPrometheusQuerierResponse
 }
 
 func (s staticPrometheusQuerier) Query(ctx context.Context, query string, ts time.Time, options ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
 	return s.queryResponse.value, nil, s.queryResponse.err
 }
 
+// QueryRange returns the query response for objective queries, the events response for event queries and the query range response for all other queries.
+// Objective vectors are converted to a matrix with a single sample per series.
 func (s staticPrometheusQuerier) QueryRange(ctx context.Context, query string, r prometheusv1.Range, options ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+	if strings.Contains(query, ":objective:") {
+		if v, ok := s.queryResponse.value.(model.Vector); ok {
+			m := make(model.Matrix, len(v))
+			for i, sample := range v {
+				m[i] = &model.SampleStream{Metric: sample.Metric, Values: []model.SamplePair{{Timestamp: sample.Timestamp, Value: sample.Value}}}
+			}
+			return m, nil, s.queryResponse.err
+		}
+		return s.queryResponse.value, nil, s.queryResponse.err
+	}
+	if strings.Contains(query, "increase(") {
+		return s.eventsResponse.value, nil, s.eventsResponse.err
+	}
 	return s.queryRangeResponse.value, nil, s.queryRangeResponse.err
 }
 
+// staticClusterLister returns the clusters by tenant
+type staticClusterLister map[string][]string
+
+func (s staticClusterLister) ListClusters(ctx context.Context, tenant string) ([]string, error) {
+	return s[tenant], nil
+}
+
+// knownClustersLister returns the downtimes of the known clusters and types.ErrNotFound for all others
+type knownClustersLister struct {
+	clusterDowntimeLister
+	known []string
+}
+
+func (s knownClustersLister) ListWindowsMatchingClusterFacts(ctx context.Context, from time.Time, to time.Time, clusterId string) ([]types.DowntimeWindow, error) {
+	if !slices.Contains(s.known, clusterId) {
+		return nil, fmt.Errorf("unable to get facts for cluster %q: %w", clusterId, types.ErrNotFound)
+	}
+	return s.clusterDowntimeLister.ListWindowsMatchingClusterFacts(ctx, from, to, clusterId)
+}
+
+// clusterDowntimeLister returns the downtimes by cluster
+type clusterDowntimeLister map[string][]types.DowntimeWindow
+
+func (s clusterDowntimeLister) ListWindows(from time.Time, to time.Time) ([]types.DowntimeWindow, error) {
+	return slices.Concat(slices.Collect(maps.Values(s))...), nil
+}
+
+func (s clusterDowntimeLister) ListWindowsMatchingClusterFacts(ctx context.Context, from time.Time, to time.Time, clusterId string) ([]types.DowntimeWindow, error) {
+	return slices.Clone(s[clusterId]), nil
+}
+
+func (s clusterDowntimeLister) ListWindowsMatchingClusterFactsAsOf(ctx context.Context, from time.Time, to time.Time, clusterId string, asOf time.Time) ([]types.DowntimeWindow, error) {
+	return slices.Clone(s[clusterId]), nil
+}
+
+// recordingPrometheusQuerier records the range queries before returning the static responses.
+type recordingPrometheusQuerier struct {
+	staticPrometheusQuerier
+	rangeQueries []string
+	ranges       []prometheusv1.Range
+}
+
+func (s *recordingPrometheusQuerier) QueryRange(ctx context.Context, query string, r prometheusv1.Range, options ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+	s.rangeQueries = append(s.rangeQueries, query)
+	s.ranges = append(s.ranges, r)
+	return s.staticPrometheusQuerier.QueryRange(ctx, query, r, options...)
+}
+
 // promMatrix creates a matrix from the given sample streams.
 func promMatrix(ss ...model.SampleStream) model.Value {
 	m := make(model.Matrix, len(ss))
@@ -242,13 +1443,20 @@ func parseValue(s string) (int, float64, error) {
 // and increasing by 1 hour for each value in `values`.
 func promSampleStream(t *testing.T, m model.Metric, from time.Time, values string) model.SampleStream {
 	t.Helper()
+	return promSampleStreamWithStep(t, m, from, time.Hour, values)
+}
+
+// promSampleStreamWithStep creates a sample stream with samples starting at `from`
+// and increasing by `step` for each value in `values`.
+func promSampleStreamWithStep(t *testing.T, m model.Metric, from time.Time, step time.Duration, values string) model.SampleStream {
+	t.Helper()
 
 	exploded := explodeValues(t, values)
 	sps := make([]model.SamplePair, len(exploded))
 	for i := range exploded {
 		sps[i] = model.SamplePair{
 			Value:     model.SampleValue(exploded[i]),
-			Timestamp: model.TimeFromUnixNano(from.Add(time.Duration(i+1) * time.Hour).UnixNano()),
+			Timestamp: model.TimeFromUnixNano(from.Add(time.Duration(i+1) * step).UnixNano()),
 		}
 	}
 	t.Logf("Exploded values for %v: %v", m, sps)
@@ -0,0 +1,50 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/api/handler"
+	"github.com/vshn/vshn-sli-reporting/pkg/report"
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+type reportServer struct {
+	generator *report.Generator
+	renderer  *report.Renderer
+}
+
+func (s *reportServer) ReportCluster(r *http.Request) (any, error) {
+	clusterID := r.PathValue("clusterid")
+	format := report.FormatHTML
+	if f := r.URL.Query().Get("format"); f != "" {
+		var err error
+		format, err = report.ParseFormat(f)
+		if err != nil {
+			return nil, handler.NewErrWithCode(err, http.StatusBadRequest)
+		}
+	}
+
+	data, err := s.generator.ClusterData(r.Context(), clusterID, r.URL.Query())
+	if apierrors.IsNotFound(err) || errors.Is(err, types.ErrNotFound) {
+		return nil, handler.NewErrWithCode(fmt.Errorf("cluster %q not found", clusterID), http.StatusNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := s.renderer.Render(&buf, format, data); err != nil {
+		return nil, err
+	}
+	return handler.RawResponse{ContentType: format.ContentType(), Body: buf.Bytes()}, nil
+}
+
+func Setup(mux *http.ServeMux, generator *report.Generator, renderer *report.Renderer) {
+	s := reportServer{generator: generator, renderer: renderer}
+	mux.Handle("GET /report/cluster/{clusterid}", handler.JSONFunc(s.ReportCluster))
+}
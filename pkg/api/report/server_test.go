@@ -0,0 +1,89 @@
+package report
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/api/query"
+	"github.com/vshn/vshn-sli-reporting/pkg/report"
+	"github.com/vshn/vshn-sli-reporting/pkg/store/mock"
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+func setup(t *testing.T) *http.ServeMux {
+	store := &mock.MockDowntimeStore{}
+	clusters := staticLieutenant{"c-cluster": {ID: "c-cluster", DisplayName: "Production"}}
+	renderer, err := report.NewRenderer("", "")
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	Setup(mux, report.NewGenerator(query.NewQuerier(store, emptyPrometheus{}, clusters, query.Config{}), clusters), renderer)
+	return mux
+}
+
+func TestReportCluster(t *testing.T) {
+	mux := setup(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/report/cluster/c-cluster?period=2026-09", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<h1>SLA Report Production</h1>")
+
+	req = httptest.NewRequest(http.MethodGet, "/report/cluster/c-cluster?period=2026-09&format=markdown", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "# SLA Report Production")
+}
+
+func TestReportClusterErrors(t *testing.T) {
+	mux := setup(t)
+
+	for query, code := range map[string]int{
+		"/report/cluster/c-cluster?period=2026-09&format=pdf": http.StatusBadRequest,
+		"/report/cluster/c-cluster?period=2026-13":            http.StatusBadRequest,
+		"/report/cluster/c-unknown?period=2026-09":            http.StatusNotFound,
+	} {
+		req := httptest.NewRequest(http.MethodGet, query, nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		assert.Equal(t, code, w.Code, query)
+	}
+}
+
+type staticLieutenant map[string]types.Cluster
+
+func (s staticLieutenant) ListClusters(ctx context.Context, tenant string) ([]string, error) {
+	return nil, nil
+}
+
+func (s staticLieutenant) GetCluster(ctx context.Context, clusterID string) (types.Cluster, error) {
+	c, ok := s[clusterID]
+	if !ok {
+		return types.Cluster{}, apierrors.NewNotFound(schema.GroupResource{Group: "syn.tools", Resource: "clusters"}, clusterID)
+	}
+	return c, nil
+}
+
+type emptyPrometheus struct{}
+
+func (m emptyPrometheus) Query(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+	return model.Vector{}, nil, nil
+}
+
+func (m emptyPrometheus) QueryRange(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+	return model.Matrix{}, nil, nil
+}
@@ -0,0 +1,48 @@
+package status
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/api/handler"
+)
+
+// CacheStatus is implemented by cluster sources that serve cached data, see lieutenant.CachingClient
+type CacheStatus interface {
+	LastSync() time.Time
+	Stale() bool
+}
+
+type Status struct {
+	Lieutenant LieutenantStatus `json:"lieutenant"`
+}
+
+type LieutenantStatus struct {
+	// Cached is true if the clusters are served from a cache
+	Cached bool `json:"cached"`
+	// LastSync is the time the cache was last known to be in sync with Lieutenant
+	LastSync *time.Time `json:"last_sync,omitempty"`
+	// Stale is true if the cache did not sync within the staleness bound
+	Stale bool `json:"stale"`
+}
+
+type statusServer struct {
+	lieutenant any
+}
+
+func (s *statusServer) GetStatus(r *http.Request) (any, error) {
+	status := Status{}
+	if c, ok := s.lieutenant.(CacheStatus); ok {
+		status.Lieutenant.Cached = true
+		status.Lieutenant.Stale = c.Stale()
+		if lastSync := c.LastSync(); !lastSync.IsZero() {
+			status.Lieutenant.LastSync = &lastSync
+		}
+	}
+	return status, nil
+}
+
+func Setup(mux *http.ServeMux, lieutenant any) {
+	s := statusServer{lieutenant: lieutenant}
+	mux.Handle("GET /status", handler.JSONFunc(s.GetStatus))
+}
@@ -0,0 +1,71 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticCacheStatus struct {
+	lastSync time.Time
+	stale    bool
+}
+
+func (s staticCacheStatus) LastSync() time.Time {
+	return s.lastSync
+}
+
+func (s staticCacheStatus) Stale() bool {
+	return s.stale
+}
+
+func TestGetStatus(t *testing.T) {
+	lastSync := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tcs := map[string]struct {
+		lieutenant any
+		expected   LieutenantStatus
+	}{
+		"live client": {
+			lieutenant: struct{}{},
+			expected:   LieutenantStatus{},
+		},
+		"synced cache": {
+			lieutenant: staticCacheStatus{lastSync: lastSync},
+			expected:   LieutenantStatus{Cached: true, LastSync: &lastSync},
+		},
+		"stale cache": {
+			lieutenant: staticCacheStatus{lastSync: lastSync, stale: true},
+			expected:   LieutenantStatus{Cached: true, LastSync: &lastSync, Stale: true},
+		},
+		"never synced": {
+			lieutenant: staticCacheStatus{stale: true},
+			expected:   LieutenantStatus{Cached: true, Stale: true},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			Setup(mux, tc.lieutenant)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var status Status
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+			assert.Equal(t, tc.expected.Cached, status.Lieutenant.Cached)
+			assert.Equal(t, tc.expected.Stale, status.Lieutenant.Stale)
+			if tc.expected.LastSync == nil {
+				assert.Nil(t, status.Lieutenant.LastSync)
+			} else {
+				require.NotNil(t, status.Lieutenant.LastSync)
+				assert.True(t, tc.expected.LastSync.Equal(*status.Lieutenant.LastSync))
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package audit
+
+import "context"
+
+// Actor identifies who triggered a change and through which request.
+type Actor struct {
+	User              string
+	RequestID         string
+	InternalRequestID string
+}
+
+type actorKey struct{}
+
+// NewContext returns a copy of ctx carrying the actor.
+func NewContext(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// FromContext returns the actor stored in ctx, or an empty actor if there is none.
+func FromContext(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorKey{}).(Actor)
+	return a
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/api/query"
+	"github.com/vshn/vshn-sli-reporting/pkg/report"
+	"github.com/vshn/vshn-sli-reporting/pkg/store"
+)
+
+var (
+	reportFormat   string
+	reportTemplate string
+	reportOutput   string
+	reportParams   = map[string]*string{}
+	reportCmd      = &cobra.Command{
+		Use:   "report CLUSTER_ID",
+		Short: "Render the SLA report of a cluster",
+		Long:  "Render the SLA report of a cluster as HTML or Markdown. The SLI data is queried the same way as by `GET /query/cluster/{clusterid}`.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			format, err := report.ParseFormat(reportFormat)
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+			var renderer *report.Renderer
+			if format == report.FormatHTML {
+				renderer, err = report.NewRenderer(reportTemplate, "")
+			} else {
+				renderer, err = report.NewRenderer("", reportTemplate)
+			}
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+
+			lieutenant, err := newLieutenantClient(context.Background(), lieutenantConfig, clusterInventoryFile, 0)
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+			store, err := store.Open(dbURL, dbPath, lieutenant)
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+			defer store.CloseDB()
+			if err := store.VerifySchema(false); err != nil {
+				log.Fatal(err)
+				return
+			}
+			prom, err := newPrometheusAPI(promConfig)
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+
+			params := url.Values{}
+			for name, v := range reportParams {
+				if *v != "" {
+					params.Set(name, *v)
+				}
+			}
+			generator := report.NewGenerator(query.NewQuerier(store, prom, lieutenant, serverConfig.Query), lieutenant)
+			data, err := generator.ClusterData(context.Background(), args[0], params)
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+
+			var out io.Writer = os.Stdout
+			if reportOutput != "" && reportOutput != "-" {
+				f, err := os.Create(reportOutput)
+				if err != nil {
+					log.Fatal(err)
+					return
+				}
+				defer f.Close()
+				out = f
+			}
+			if err := renderer.Render(out, format, data); err != nil {
+				log.Fatal(err)
+				return
+			}
+		},
+	}
+)
+
+func init() {
+	reportCmd.Flags().StringVar(&reportFormat, "format", "markdown", "Format of the report, either html or markdown")
+	reportCmd.Flags().StringVar(&reportTemplate, "template", "", "Path of a Go template for the report, defaults to the built-in template of the format")
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", "", "File to write the report to, defaults to stdout")
+	for _, p := range []struct{ name, flag, usage string }{
+		{"from", "from", "Start of the reporting period (RFC3339)"},
+		{"to", "to", "End of the reporting period (RFC3339)"},
+		{"period", "period", "Calendar period instead of from and to, e.g. 2026-09, 2026-Q3 or last-30d"},
+		{"tz", "tz", "Timezone of the period, e.g. Europe/Zurich"},
+		{"step", "step", "Resolution of the SLI data, defaults to 1h"},
+		{"missing_data", "missing-data", "Policy for missing data, one of good, bad or exclude"},
+		{"weighting", "weighting", "Weighting of the error rate, either hours or requests"},
+		{"filter", "filter", "Regular expression the SLO IDs have to match"},
+		{"as_of", "as-of", "Use the downtime windows as they were known at this time (RFC3339)"},
+	} {
+		reportParams[p.name] = reportCmd.Flags().String(p.flag, "", p.usage)
+	}
+	addStoreFlags(reportCmd.Flags())
+	addLieutenantFlags(reportCmd.Flags())
+	addPrometheusFlags(reportCmd.Flags())
+
+	rootCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,156 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+// Inventory is the content of a cluster inventory file, e.g.
+//
+//	clusters:
+//	  - id: c-example
+//	    display_name: Example
+//	    tenant: t-example
+//	    labels:
+//	      env: prod
+//	    facts:
+//	      cloud: cloudscale
+//	      distribution: openshift4
+//
+// JSON files use the same structure.
+type Inventory struct {
+	Clusters []types.Cluster `json:"clusters"`
+}
+
+// Client serves the clusters of an inventory file instead of Lieutenant.
+// The file is reloaded when its modification time or size changes.
+// If the changed file cannot be loaded, the previously loaded clusters are served.
+type Client struct {
+	path string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	size     int64
+	clusters map[string]types.Cluster
+}
+
+// NewClient loads the inventory file at path
+func NewClient(path string) (*Client, error) {
+	c := &Client{path: path}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load reads and validates the inventory file at path
+func Load(path string) (Inventory, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Inventory{}, fmt.Errorf("could not read cluster inventory: %w", err)
+	}
+	inv := Inventory{}
+	if err := yaml.UnmarshalStrict(content, &inv); err != nil {
+		return Inventory{}, fmt.Errorf("could not parse cluster inventory %q: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for i, c := range inv.Clusters {
+		if c.ID == "" {
+			return Inventory{}, fmt.Errorf("invalid cluster inventory %q: clusters[%d] has no ID", path, i)
+		}
+		if seen[c.ID] {
+			return Inventory{}, fmt.Errorf("invalid cluster inventory %q: duplicate cluster %q", path, c.ID)
+		}
+		seen[c.ID] = true
+	}
+	return inv, nil
+}
+
+// reload loads the inventory file if it changed since it was last loaded
+func (c *Client) reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return fmt.Errorf("could not read cluster inventory: %w", err)
+	}
+	if c.clusters != nil && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return nil
+	}
+
+	inv, err := Load(c.path)
+	if err != nil {
+		return err
+	}
+	clusters := make(map[string]types.Cluster, len(inv.Clusters))
+	for _, cluster := range inv.Clusters {
+		clusters[cluster.ID] = cluster
+	}
+	c.clusters = clusters
+	c.modTime = info.ModTime()
+	c.size = info.Size()
+	return nil
+}
+
+// current returns the clusters of the inventory, reloading the file if it changed
+func (c *Client) current(ctx context.Context) map[string]types.Cluster {
+	if err := c.reload(); err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "Failed to reload cluster inventory, serving previously loaded clusters", "path", c.path)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clusters
+}
+
+// GetCluster returns the metadata of the cluster
+func (c *Client) GetCluster(ctx context.Context, cluster_id string) (types.Cluster, error) {
+	cluster, ok := c.current(ctx)[cluster_id]
+	if !ok {
+		return types.Cluster{}, fmt.Errorf("%w: cluster %q is not in the inventory", types.ErrNotFound, cluster_id)
+	}
+	return cluster, nil
+}
+
+// GetClusterMatchContext returns the values downtime windows are matched against, see types.Cluster.MatchContext
+func (c *Client) GetClusterMatchContext(ctx context.Context, cluster_id string) (map[string]string, error) {
+	cluster, err := c.GetCluster(ctx, cluster_id)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.MatchContext(), nil
+}
+
+// GetClusters returns the metadata of all clusters, sorted by ID
+func (c *Client) GetClusters(ctx context.Context) ([]types.Cluster, error) {
+	clusters := []types.Cluster{}
+	for _, cluster := range c.current(ctx) {
+		clusters = append(clusters, cluster)
+	}
+	slices.SortFunc(clusters, func(a, b types.Cluster) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return clusters, nil
+}
+
+// ListClusters returns the sorted IDs of all clusters, or only of the clusters of the given tenant if tenant is not empty
+func (c *Client) ListClusters(ctx context.Context, tenant string) ([]string, error) {
+	ids := []string{}
+	for id, cluster := range c.current(ctx) {
+		if tenant == "" || cluster.Tenant == tenant {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
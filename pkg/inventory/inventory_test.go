@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+const testInventory = `
+clusters:
+  - id: c-one
+    display_name: One
+    tenant: t-a
+    labels:
+      env: prod
+    facts:
+      cloud: cloudscale
+      distribution: openshift4
+  - id: c-two
+    tenant: t-b
+    facts:
+      cloud: exoscale
+  - id: c-three
+    tenant: t-a
+`
+
+func writeInventory(t *testing.T, path string, content string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "inventory.yaml")
+	writeInventory(t, path, testInventory, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+
+	c, err := NewClient(path)
+	require.NoError(t, err)
+
+	cluster, err := c.GetCluster(ctx, "c-one")
+	require.NoError(t, err)
+	assert.Equal(t, types.Cluster{
+		ID:          "c-one",
+		DisplayName: "One",
+		Tenant:      "t-a",
+		Labels:      map[string]string{"env": "prod"},
+		Facts:       map[string]string{"cloud": "cloudscale", "distribution": "openshift4"},
+	}, cluster)
+
+	cluster, err = c.GetCluster(ctx, "c-two")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cloud": "exoscale"}, cluster.Facts)
+
+	mc, err := c.GetClusterMatchContext(ctx, "c-one")
+	require.NoError(t, err)
+	assert.Equal(t, "t-a", mc[types.MatchKeyTenant])
+	assert.Equal(t, "prod", mc[types.MatchKeyLabelPrefix+"env"])
+
+	ids, err := c.ListClusters(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-one", "c-three", "c-two"}, ids)
+	ids, err = c.ListClusters(ctx, "t-a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-one", "c-three"}, ids)
+
+	clusters, err := c.GetClusters(ctx)
+	require.NoError(t, err)
+	require.Len(t, clusters, 3)
+	assert.Equal(t, "c-one", clusters[0].ID)
+
+	_, err = c.GetCluster(ctx, "c-unknown")
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	_, err = c.GetClusterMatchContext(ctx, "c-unknown")
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
+
+func TestClientReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	writeInventory(t, path, `{"clusters": [{"id": "c-one", "facts": {"cloud": "cloudscale"}}]}`, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+
+	c, err := NewClient(path)
+	require.NoError(t, err)
+	ids, err := c.ListClusters(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-one"}, ids)
+
+	writeInventory(t, path, `{"clusters": [{"id": "c-one", "facts": {"cloud": "exoscale"}}, {"id": "c-two"}]}`, time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC))
+	ids, err = c.ListClusters(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-one", "c-two"}, ids)
+	cluster, err := c.GetCluster(ctx, "c-one")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cloud": "exoscale"}, cluster.Facts)
+
+	writeInventory(t, path, `{"clusters": [`, time.Date(2026, 10, 3, 0, 0, 0, 0, time.UTC))
+	ids, err = c.ListClusters(ctx, "")
+	require.NoError(t, err, "an invalid file should not replace the loaded clusters")
+	assert.Equal(t, []string{"c-one", "c-two"}, ids)
+
+	require.NoError(t, os.Remove(path))
+	ids, err = c.ListClusters(ctx, "")
+	require.NoError(t, err, "a removed file should not replace the loaded clusters")
+	assert.Equal(t, []string{"c-one", "c-two"}, ids)
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"missing ID":    "clusters:\n  - tenant: t-a\n",
+		"duplicate ID":  "clusters:\n  - id: c-one\n  - id: c-one\n",
+		"unknown field": "clusters:\n  - id: c-one\n    fact:\n      cloud: cloudscale\n",
+		"invalid yaml":  "clusters: [",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "inventory.yaml")
+			writeInventory(t, path, content, time.Now())
+			_, err := NewClient(path)
+			assert.Error(t, err)
+		})
+	}
+	_, err := NewClient(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
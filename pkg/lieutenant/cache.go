@@ -0,0 +1,247 @@
+package lieutenant
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	lieutenantv1alpha1 "github.com/projectsyn/lieutenant-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+// CachingClient serves the Lieutenant clusters from memory.
+// The cache is filled by listing all clusters and kept up to date by Run, which watches them.
+// Only a cache which never synced is synced before answering, afterwards the last known clusters are served,
+// even if Lieutenant is unreachable and the cache becomes stale. Requests to a stale cache start a resync
+// in the background, in case Run is stuck.
+type CachingClient struct {
+	client    k8sClient.WithWatch
+	namespace string
+	staleness time.Duration
+	now       func() time.Time
+
+	// syncMu serializes syncs
+	syncMu sync.Mutex
+	// resyncing is set while a resync started by a request is running
+	resyncing atomic.Bool
+
+	mu       sync.RWMutex
+	clusters map[string]types.Cluster
+	lastSync time.Time
+}
+
+func NewCachingLieutenantClient(config Config, staleness time.Duration) (*CachingClient, error) {
+	c, err := newK8sClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewCachingClient(c, config.Namespace, staleness), nil
+}
+
+func NewCachingClient(c k8sClient.WithWatch, namespace string, staleness time.Duration) *CachingClient {
+	return &CachingClient{
+		client:    c,
+		namespace: namespace,
+		staleness: staleness,
+		now:       time.Now,
+		clusters:  map[string]types.Cluster{},
+	}
+}
+
+// Run keeps the cache up to date until the context is cancelled
+func (c *CachingClient) Run(ctx context.Context) {
+	l := logr.FromContextOrDiscard(ctx)
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := c.syncAndWatch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			l.Error(err, "Failed to watch Lieutenant clusters, retrying", "backoff", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, max(c.staleness, time.Second))
+			continue
+		}
+		backoff = time.Second
+	}
+}
+
+// syncAndWatch lists all clusters and applies the watch events until the watch ends.
+// Bookmarks confirm that a quiet watch is still in sync. If the watch is quiet for half of the staleness bound,
+// e.g. because the API server does not send bookmarks, it is ended so that the clusters are listed again.
+func (c *CachingClient) syncAndWatch(ctx context.Context) error {
+	resourceVersion, err := c.sync(ctx)
+	if err != nil {
+		return err
+	}
+	w, err := c.client.Watch(ctx, &lieutenantv1alpha1.ClusterList{}, k8sClient.InNamespace(c.namespace), &k8sClient.ListOptions{Raw: &metav1.ListOptions{ResourceVersion: resourceVersion, AllowWatchBookmarks: true}})
+	if err != nil {
+		return fmt.Errorf("could not watch clusters: %w", err)
+	}
+	defer w.Stop()
+
+	quiet := time.NewTimer(c.staleness / 2)
+	defer quiet.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-quiet.C:
+			return nil
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return nil
+			}
+			switch ev.Type {
+			case watch.Added, watch.Modified, watch.Deleted:
+				cluster, ok := ev.Object.(*lieutenantv1alpha1.Cluster)
+				if !ok {
+					return fmt.Errorf("unexpected object in cluster watch: %T", ev.Object)
+				}
+				c.mu.Lock()
+				if ev.Type == watch.Deleted {
+					delete(c.clusters, cluster.Name)
+				} else {
+					c.clusters[cluster.Name] = toCluster(*cluster)
+				}
+				c.lastSync = c.now()
+				c.mu.Unlock()
+			case watch.Bookmark:
+				c.mu.Lock()
+				c.lastSync = c.now()
+				c.mu.Unlock()
+			case watch.Error:
+				return fmt.Errorf("cluster watch failed: %w", apierrors.FromObject(ev.Object))
+			}
+			quiet.Reset(c.staleness / 2)
+		}
+	}
+}
+
+// Sync replaces the cache with the current clusters from Lieutenant
+func (c *CachingClient) Sync(ctx context.Context) error {
+	_, err := c.sync(ctx)
+	return err
+}
+
+func (c *CachingClient) sync(ctx context.Context) (string, error) {
+	c.syncMu.Lock()
+	defer c.syncMu.Unlock()
+
+	var list lieutenantv1alpha1.ClusterList
+	if err := c.client.List(ctx, &list, k8sClient.InNamespace(c.namespace)); err != nil {
+		return "", fmt.Errorf("could not list clusters: %w", err)
+	}
+	clusters := make(map[string]types.Cluster, len(list.Items))
+	for _, cluster := range list.Items {
+		clusters[cluster.Name] = toCluster(cluster)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clusters = clusters
+	c.lastSync = c.now()
+	return list.ResourceVersion, nil
+}
+
+// LastSync returns the time the cache was last known to be in sync with Lieutenant, zero if it never synced
+func (c *CachingClient) LastSync() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastSync
+}
+
+// Stale returns true if the cache did not sync within the staleness bound
+func (c *CachingClient) Stale() bool {
+	lastSync := c.LastSync()
+	return lastSync.IsZero() || c.now().Sub(lastSync) > c.staleness
+}
+
+// ensureSynced syncs the cache if it never synced.
+// Afterwards Run keeps the cache up to date and requests never wait for Lieutenant.
+// If the cache is stale nonetheless, a resync is started in the background.
+func (c *CachingClient) ensureSynced(ctx context.Context) error {
+	if c.LastSync().IsZero() {
+		return c.Sync(ctx)
+	}
+	if c.Stale() && c.resyncing.CompareAndSwap(false, true) {
+		go func() {
+			defer c.resyncing.Store(false)
+			// the resync must not end with the request which started it
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), max(c.staleness, time.Second))
+			defer cancel()
+			if err := c.Sync(ctx); err != nil {
+				logr.FromContextOrDiscard(ctx).Error(err, "Failed to resync stale Lieutenant cluster cache")
+			}
+		}()
+	}
+	return nil
+}
+
+// GetClusterMatchContext returns the values downtime windows are matched against, see types.Cluster.MatchContext
+func (c *CachingClient) GetClusterMatchContext(ctx context.Context, cluster_id string) (map[string]string, error) {
+	cluster, err := c.GetCluster(ctx, cluster_id)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.MatchContext(), nil
+}
+
+// GetCluster returns the metadata of the cluster
+func (c *CachingClient) GetCluster(ctx context.Context, cluster_id string) (types.Cluster, error) {
+	if err := c.ensureSynced(ctx); err != nil {
+		return types.Cluster{}, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cluster, ok := c.clusters[cluster_id]
+	if !ok {
+		return types.Cluster{}, apierrors.NewNotFound(lieutenantv1alpha1.GroupVersion.WithResource("clusters").GroupResource(), cluster_id)
+	}
+	return cluster, nil
+}
+
+// ListClusters returns the sorted IDs of all clusters, or only of the clusters of the given tenant if tenant is not empty
+func (c *CachingClient) ListClusters(ctx context.Context, tenant string) ([]string, error) {
+	if err := c.ensureSynced(ctx); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ids := []string{}
+	for _, id := range slices.Sorted(maps.Keys(c.clusters)) {
+		if tenant == "" || c.clusters[id].Tenant == tenant {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// GetClusters returns the metadata of all clusters, sorted by ID
+func (c *CachingClient) GetClusters(ctx context.Context) ([]types.Cluster, error) {
+	if err := c.ensureSynced(ctx); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	clusters := make([]types.Cluster, 0, len(c.clusters))
+	for _, id := range slices.Sorted(maps.Keys(c.clusters)) {
+		clusters = append(clusters, c.clusters[id])
+	}
+	return clusters, nil
+}
@@ -0,0 +1,261 @@
+package lieutenant
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lieutenantv1alpha1 "github.com/projectsyn/lieutenant-operator/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+func newCluster(id, tenant string, facts map[string]string) *lieutenantv1alpha1.Cluster {
+	return &lieutenantv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: id, Namespace: "lieutenant", Labels: map[string]string{"syn.tools/origin": "lieutenant"}},
+		Spec: lieutenantv1alpha1.ClusterSpec{
+			DisplayName: id + " display",
+			TenantRef:   corev1.LocalObjectReference{Name: tenant},
+			Facts:       facts,
+		},
+		Status: lieutenantv1alpha1.ClusterStatus{
+			Facts: map[string]string{"kubernetesVersion": "1.33"},
+		},
+	}
+}
+
+func newFakeClient(t *testing.T, funcs interceptor.Funcs, objs ...k8sClient.Object) k8sClient.WithWatch {
+	scheme := runtime.NewScheme()
+	require.NoError(t, lieutenantv1alpha1.AddToScheme(scheme))
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithInterceptorFuncs(funcs).Build()
+}
+
+func TestCachingClientSync(t *testing.T) {
+	ctx := context.Background()
+	c := NewCachingClient(newFakeClient(t, interceptor.Funcs{},
+		newCluster("c-one", "t-a", map[string]string{"cloud": "cloudscale"}),
+		newCluster("c-two", "t-b", nil),
+		newCluster("c-three", "t-a", nil),
+	), "lieutenant", time.Minute)
+
+	assert.True(t, c.Stale())
+	assert.True(t, c.LastSync().IsZero())
+
+	cluster, err := c.GetCluster(ctx, "c-one")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cloud": "cloudscale"}, cluster.Facts)
+	assert.False(t, c.Stale())
+
+	cluster, err = c.GetCluster(ctx, "c-two")
+	require.NoError(t, err)
+	assert.Equal(t, types.Cluster{
+		ID:           "c-two",
+		DisplayName:  "c-two display",
+		Tenant:       "t-b",
+		Labels:       map[string]string{"syn.tools/origin": "lieutenant"},
+		DynamicFacts: map[string]string{"kubernetesVersion": "1.33"},
+	}, cluster)
+
+	ids, err := c.ListClusters(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-one", "c-three", "c-two"}, ids)
+	ids, err = c.ListClusters(ctx, "t-a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-one", "c-three"}, ids)
+
+	mc, err := c.GetClusterMatchContext(ctx, "c-one")
+	require.NoError(t, err)
+	assert.Equal(t, "cloudscale", mc["cloud"])
+	assert.Equal(t, "c-one", mc[types.MatchKeyClusterID])
+	assert.Equal(t, "t-a", mc[types.MatchKeyTenant])
+	assert.Equal(t, "c-one display", mc[types.MatchKeyDisplayName])
+	assert.Equal(t, "lieutenant", mc[types.MatchKeyLabelPrefix+"syn.tools/origin"])
+	assert.Equal(t, "1.33", mc[types.MatchKeyDynamicFactPrefix+"kubernetesVersion"])
+
+	clusters, err := c.GetClusters(ctx)
+	require.NoError(t, err)
+	require.Len(t, clusters, 3)
+	assert.Equal(t, "c-one", clusters[0].ID)
+	assert.Equal(t, "c-two", clusters[2].ID)
+
+	_, err = c.GetCluster(ctx, "c-unknown")
+	assert.True(t, apierrors.IsNotFound(err), "expected NotFound, got %v", err)
+}
+
+func TestCachingClientStaleness(t *testing.T) {
+	ctx := context.Background()
+	var lists atomic.Int32
+	client := newFakeClient(t, interceptor.Funcs{
+		List: func(ctx context.Context, client k8sClient.WithWatch, list k8sClient.ObjectList, opts ...k8sClient.ListOption) error {
+			lists.Add(1)
+			return client.List(ctx, list, opts...)
+		},
+	}, newCluster("c-one", "t-a", nil))
+	c := NewCachingClient(client, "lieutenant", time.Minute)
+	var now atomic.Pointer[time.Time]
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	now.Store(&start)
+	c.now = func() time.Time { return *now.Load() }
+
+	_, err := c.GetCluster(ctx, "c-one")
+	require.NoError(t, err)
+	_, err = c.GetCluster(ctx, "c-one")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), lists.Load(), "synced cache should not be synced again")
+	assert.False(t, c.Stale())
+
+	// Run is not running, so nothing keeps the cache up to date
+	require.NoError(t, client.Create(ctx, newCluster("c-two", "t-b", nil)))
+	later := start.Add(2 * time.Minute)
+	now.Store(&later)
+	assert.True(t, c.Stale())
+	_, err = c.GetCluster(ctx, "c-two")
+	assert.True(t, apierrors.IsNotFound(err), "stale cache should answer without waiting for the resync")
+
+	assert.Eventually(t, func() bool { return !c.Stale() }, 5*time.Second, 10*time.Millisecond, "stale cache should be resynced")
+	_, err = c.GetCluster(ctx, "c-two")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), lists.Load())
+}
+
+func TestCachingClientFallback(t *testing.T) {
+	ctx := context.Background()
+	unreachable := false
+	c := NewCachingClient(newFakeClient(t, interceptor.Funcs{
+		List: func(ctx context.Context, client k8sClient.WithWatch, list k8sClient.ObjectList, opts ...k8sClient.ListOption) error {
+			if unreachable {
+				return errors.New("connection refused")
+			}
+			return client.List(ctx, list, opts...)
+		},
+	}, newCluster("c-one", "t-a", map[string]string{"cloud": "exoscale"})), "lieutenant", time.Minute)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	unreachable = true
+	_, err := c.GetCluster(ctx, "c-one")
+	assert.ErrorContains(t, err, "connection refused", "never synced cache should return the error")
+
+	unreachable = false
+	_, err = c.GetCluster(ctx, "c-one")
+	require.NoError(t, err)
+	syncedAt := now
+
+	unreachable = true
+	now = now.Add(time.Hour)
+	cluster, err := c.GetCluster(ctx, "c-one")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cloud": "exoscale"}, cluster.Facts)
+	assert.True(t, c.Stale())
+	assert.Equal(t, syncedAt, c.LastSync())
+}
+
+func TestCachingClientQuietWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watchers := make(chan *watch.FakeWatcher, 1)
+	var watchOpts k8sClient.ListOptions
+	client := newFakeClient(t, interceptor.Funcs{
+		Watch: func(ctx context.Context, client k8sClient.WithWatch, list k8sClient.ObjectList, opts ...k8sClient.ListOption) (watch.Interface, error) {
+			watchOpts.ApplyOptions(opts)
+			w := watch.NewFake()
+			watchers <- w
+			return w, nil
+		},
+	}, newCluster("c-one", "t-a", nil))
+	c := NewCachingClient(client, "lieutenant", time.Hour)
+	go c.Run(ctx)
+
+	var w *watch.FakeWatcher
+	select {
+	case w = <-watchers:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cache did not start watching")
+	}
+	require.NotNil(t, watchOpts.Raw)
+	assert.True(t, watchOpts.Raw.AllowWatchBookmarks)
+
+	synced := c.LastSync()
+	time.Sleep(10 * time.Millisecond)
+	w.Action(watch.Bookmark, &lieutenantv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "42"}})
+	assert.Eventually(t, func() bool { return c.LastSync().After(synced) }, 5*time.Second, 10*time.Millisecond, "bookmarks should confirm the cache is in sync")
+}
+
+func TestCachingClientQuietWatchWithoutBookmarks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the watch never delivers an event
+	client := newFakeClient(t, interceptor.Funcs{
+		Watch: func(ctx context.Context, client k8sClient.WithWatch, list k8sClient.ObjectList, opts ...k8sClient.ListOption) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}, newCluster("c-one", "t-a", nil))
+	c := NewCachingClient(client, "lieutenant", 200*time.Millisecond)
+	go c.Run(ctx)
+
+	assert.Eventually(t, func() bool { return !c.LastSync().IsZero() }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, client.Create(ctx, newCluster("c-two", "t-b", nil)))
+	assert.Never(t, c.Stale, time.Second, 10*time.Millisecond, "a quiet watch should not make the cache stale")
+	ids, err := c.ListClusters(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-one", "c-two"}, ids, "changes missed by the watch should be picked up by resyncs")
+}
+
+func TestCachingClientRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watching := make(chan struct{}, 1)
+	client := newFakeClient(t, interceptor.Funcs{
+		Watch: func(ctx context.Context, client k8sClient.WithWatch, list k8sClient.ObjectList, opts ...k8sClient.ListOption) (watch.Interface, error) {
+			w, err := client.Watch(ctx, list, opts...)
+			watching <- struct{}{}
+			return w, err
+		},
+	}, newCluster("c-one", "t-a", nil))
+	c := NewCachingClient(client, "lieutenant", time.Hour)
+	go c.Run(ctx)
+
+	select {
+	case <-watching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cache did not start watching")
+	}
+	ids, err := c.ListClusters(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c-one"}, ids)
+
+	require.NoError(t, client.Create(ctx, newCluster("c-two", "t-b", nil)))
+	updated := newCluster("c-one", "t-a", map[string]string{"cloud": "cloudscale"})
+	require.NoError(t, client.Patch(ctx, updated, k8sClient.Merge))
+
+	assert.EventuallyWithT(t, func(c2 *assert.CollectT) {
+		ids, err := c.ListClusters(ctx, "")
+		assert.NoError(c2, err)
+		assert.Equal(c2, []string{"c-one", "c-two"}, ids)
+		cluster, err := c.GetCluster(ctx, "c-one")
+		assert.NoError(c2, err)
+		assert.Equal(c2, map[string]string{"cloud": "cloudscale"}, cluster.Facts)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, client.Delete(ctx, newCluster("c-two", "t-b", nil)))
+	assert.EventuallyWithT(t, func(c2 *assert.CollectT) {
+		ids, err := c.ListClusters(ctx, "")
+		assert.NoError(c2, err)
+		assert.Equal(c2, []string{"c-one"}, ids)
+	}, 5*time.Second, 10*time.Millisecond)
+}
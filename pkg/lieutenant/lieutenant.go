@@ -3,8 +3,11 @@ package lieutenant
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	lieutenantv1alpha1 "github.com/projectsyn/lieutenant-operator/api/v1alpha1"
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
 	k8sClient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -22,6 +25,17 @@ type Config struct {
 }
 
 func NewLieutenantClient(config Config) (*client, error) {
+	c, err := newK8sClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		Client:    c,
+		Namespace: config.Namespace,
+	}, nil
+}
+
+func newK8sClient(config Config) (k8sClient.WithWatch, error) {
 	scheme := runtime.NewScheme()
 	err := lieutenantv1alpha1.AddToScheme(scheme)
 	if err != nil {
@@ -32,19 +46,17 @@ func NewLieutenantClient(config Config) (*client, error) {
 		Host:        config.Host, // yes this is the correct field, host accepts a url
 		BearerToken: config.Token,
 	}
-	c, err := k8sClient.New(conf, k8sClient.Options{
+	c, err := k8sClient.NewWithWatch(conf, k8sClient.Options{
 		Scheme: scheme,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
-	return &client{
-		Client:    c,
-		Namespace: config.Namespace,
-	}, nil
+	return c, nil
 }
 
-func (l *client) GetClusterFacts(ctx context.Context, cluster_id string) (map[string]string, error) {
+// GetCluster returns the metadata of the cluster
+func (l *client) GetCluster(ctx context.Context, cluster_id string) (types.Cluster, error) {
 	var cluster lieutenantv1alpha1.Cluster
 
 	nsn := k8sClient.ObjectKey{
@@ -53,8 +65,63 @@ func (l *client) GetClusterFacts(ctx context.Context, cluster_id string) (map[st
 	}
 
 	if err := l.Client.Get(ctx, nsn, &cluster); err != nil {
+		return types.Cluster{}, err
+	}
+
+	return toCluster(cluster), nil
+}
+
+// GetClusterMatchContext returns the values downtime windows are matched against, see types.Cluster.MatchContext
+func (l *client) GetClusterMatchContext(ctx context.Context, cluster_id string) (map[string]string, error) {
+	cluster, err := l.GetCluster(ctx, cluster_id)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.MatchContext(), nil
+}
+
+func toCluster(cluster lieutenantv1alpha1.Cluster) types.Cluster {
+	return types.Cluster{
+		ID:           cluster.Name,
+		DisplayName:  cluster.Spec.DisplayName,
+		Tenant:       cluster.Spec.TenantRef.Name,
+		Labels:       cluster.Labels,
+		Annotations:  cluster.Annotations,
+		Facts:        cluster.Spec.Facts,
+		DynamicFacts: cluster.Status.Facts,
+	}
+}
+
+// ListClusters returns the sorted IDs of all clusters, or only of the clusters of the given tenant if tenant is not empty
+func (l *client) ListClusters(ctx context.Context, tenant string) ([]string, error) {
+	var clusters lieutenantv1alpha1.ClusterList
+	if err := l.Client.List(ctx, &clusters, k8sClient.InNamespace(l.Namespace)); err != nil {
 		return nil, err
 	}
 
-	return cluster.Spec.Facts, nil
+	ids := []string{}
+	for _, c := range clusters.Items {
+		if tenant == "" || c.Spec.TenantRef.Name == tenant {
+			ids = append(ids, c.Name)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// GetClusters returns the metadata of all clusters, sorted by ID
+func (l *client) GetClusters(ctx context.Context) ([]types.Cluster, error) {
+	var clusters lieutenantv1alpha1.ClusterList
+	if err := l.Client.List(ctx, &clusters, k8sClient.InNamespace(l.Namespace)); err != nil {
+		return nil, err
+	}
+
+	rv := make([]types.Cluster, len(clusters.Items))
+	for i, c := range clusters.Items {
+		rv[i] = toCluster(c)
+	}
+	slices.SortFunc(rv, func(a, b types.Cluster) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return rv, nil
 }
@@ -0,0 +1,255 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Hourly  Frequency = "HOURLY"
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// maxEmptyPeriods guards against rules that can never produce an occurrence
+const maxEmptyPeriods = 100000
+
+// Rule is a parsed subset of an RFC 5545 recurrence rule.
+// Supported parts are FREQ, INTERVAL, BYDAY, BYHOUR, UNTIL and COUNT.
+// All calculations are done in UTC.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []time.Weekday
+	ByHour   []int
+	Until    *time.Time
+	Count    int
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Parse parses a recurrence rule such as "FREQ=WEEKLY;BYDAY=TU;BYHOUR=22".
+// An optional "RRULE:" prefix is accepted.
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return Rule{}, errors.New("empty recurrence rule")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			f := Frequency(strings.ToUpper(value))
+			switch f {
+			case Hourly, Daily, Weekly, Monthly:
+				r.Freq = f
+			default:
+				return Rule{}, fmt.Errorf("unsupported recurrence frequency %q", value)
+			}
+		case "INTERVAL":
+			i, err := strconv.Atoi(value)
+			if err != nil || i < 1 {
+				return Rule{}, fmt.Errorf("invalid recurrence interval %q", value)
+			}
+			r.Interval = i
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := weekdays[strings.ToUpper(d)]
+				if !ok {
+					return Rule{}, fmt.Errorf("unsupported recurrence weekday %q", d)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYHOUR":
+			for _, h := range strings.Split(value, ",") {
+				i, err := strconv.Atoi(h)
+				if err != nil || i < 0 || i > 23 {
+					return Rule{}, fmt.Errorf("invalid recurrence hour %q", h)
+				}
+				r.ByHour = append(r.ByHour, i)
+			}
+			slices.Sort(r.ByHour)
+		case "UNTIL":
+			u, err := parseUntil(value)
+			if err != nil {
+				return Rule{}, err
+			}
+			r.Until = &u
+		case "COUNT":
+			c, err := strconv.Atoi(value)
+			if err != nil || c < 1 {
+				return Rule{}, fmt.Errorf("invalid recurrence count %q", value)
+			}
+			r.Count = c
+		default:
+			return Rule{}, fmt.Errorf("unsupported recurrence rule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return Rule{}, errors.New("recurrence rule must contain FREQ")
+	}
+	if r.Until != nil && r.Count > 0 {
+		return Rule{}, errors.New("recurrence rule must not contain both UNTIL and COUNT")
+	}
+	return r, nil
+}
+
+func parseUntil(s string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid recurrence UNTIL %q", s)
+}
+
+// Bounded returns true if the rule produces a finite number of occurrences.
+func (r Rule) Bounded() bool {
+	return r.Until != nil || r.Count > 0
+}
+
+// Between returns the start times of all occurrences of length `duration` that overlap [from, to).
+func (r Rule) Between(dtstart time.Time, duration time.Duration, from time.Time, to time.Time) []time.Time {
+	occurrences := []time.Time{}
+	r.iterate(dtstart, to, func(t time.Time) bool {
+		if t.Add(duration).After(from) {
+			occurrences = append(occurrences, t)
+		}
+		return true
+	})
+	return occurrences
+}
+
+// Last returns the start time of the last occurrence.
+// It returns false if the rule is unbounded or has no occurrences.
+func (r Rule) Last(dtstart time.Time) (time.Time, bool) {
+	if !r.Bounded() {
+		return time.Time{}, false
+	}
+	var last time.Time
+	found := false
+	r.iterate(dtstart, time.Time{}, func(t time.Time) bool {
+		last = t
+		found = true
+		return true
+	})
+	return last, found
+}
+
+// iterate calls fn for every occurrence starting before `before` in chronological order
+// until the rule ends or fn returns false. A zero `before` does not limit the iteration.
+func (r Rule) iterate(dtstart time.Time, before time.Time, fn func(time.Time) bool) {
+	dtstart = dtstart.UTC()
+	count := 0
+	empty := 0
+	for period := 0; ; period++ {
+		periodStart, candidates := r.candidates(dtstart, period)
+		if r.Until != nil && periodStart.After(*r.Until) {
+			return
+		}
+		// candidates never start before their period
+		if !before.IsZero() && !periodStart.Before(before) {
+			return
+		}
+		emitted := false
+		for _, c := range candidates {
+			if c.Before(dtstart) {
+				continue
+			}
+			if r.Until != nil && c.After(*r.Until) || !before.IsZero() && !c.Before(before) {
+				return
+			}
+			emitted = true
+			if !fn(c) {
+				return
+			}
+			count++
+			if r.Count > 0 && count >= r.Count {
+				return
+			}
+		}
+		if emitted {
+			empty = 0
+		} else if empty++; empty > maxEmptyPeriods {
+			return
+		}
+	}
+}
+
+// candidates returns the start of the given period and all sorted occurrence candidates within it.
+func (r Rule) candidates(dtstart time.Time, period int) (time.Time, []time.Time) {
+	hours := r.ByHour
+	if len(hours) == 0 {
+		hours = []int{dtstart.Hour()}
+	}
+	y, m, d := dtstart.Date()
+	at := func(day time.Time, hour int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, dtstart.Minute(), dtstart.Second(), 0, time.UTC)
+	}
+
+	var periodStart time.Time
+	var days []time.Time
+	switch r.Freq {
+	case Hourly:
+		periodStart = dtstart.Add(time.Duration(period*r.Interval) * time.Hour)
+		if r.matchesDay(periodStart) && (len(r.ByHour) == 0 || slices.Contains(r.ByHour, periodStart.Hour())) {
+			return periodStart, []time.Time{periodStart}
+		}
+		return periodStart, nil
+	case Daily:
+		periodStart = time.Date(y, m, d+period*r.Interval, 0, 0, 0, 0, time.UTC)
+		if r.matchesDay(periodStart) {
+			days = []time.Time{periodStart}
+		}
+	case Weekly:
+		// weeks start on monday (RFC 5545 default WKST)
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		periodStart = time.Date(y, m, d-offset+7*period*r.Interval, 0, 0, 0, 0, time.UTC)
+		for i := range 7 {
+			day := periodStart.AddDate(0, 0, i)
+			if len(r.ByDay) == 0 && day.Weekday() == dtstart.Weekday() || slices.Contains(r.ByDay, day.Weekday()) {
+				days = append(days, day)
+			}
+		}
+	case Monthly:
+		periodStart = time.Date(y, m+time.Month(period*r.Interval), 1, 0, 0, 0, 0, time.UTC)
+		for day := periodStart; day.Month() == periodStart.Month(); day = day.AddDate(0, 0, 1) {
+			if len(r.ByDay) == 0 && day.Day() == d || slices.Contains(r.ByDay, day.Weekday()) {
+				days = append(days, day)
+			}
+		}
+	}
+
+	candidates := make([]time.Time, 0, len(days)*len(hours))
+	for _, day := range days {
+		for _, h := range hours {
+			candidates = append(candidates, at(day, h))
+		}
+	}
+	return periodStart, candidates
+}
+
+func (r Rule) matchesDay(t time.Time) bool {
+	return len(r.ByDay) == 0 || slices.Contains(r.ByDay, t.Weekday())
+}
@@ -0,0 +1,143 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	r, err := Parse("RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;BYHOUR=22,2;COUNT=4")
+	require.NoError(t, err)
+	assert.Equal(t, Weekly, r.Freq)
+	assert.Equal(t, 2, r.Interval)
+	assert.Equal(t, []time.Weekday{time.Tuesday, time.Thursday}, r.ByDay)
+	assert.Equal(t, []int{2, 22}, r.ByHour)
+	assert.Equal(t, 4, r.Count)
+	assert.True(t, r.Bounded())
+
+	r, err = Parse("FREQ=DAILY;UNTIL=20200110T000000Z")
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.Interval)
+	assert.True(t, mustTime(t, "2020-01-10T00:00:00Z").Equal(*r.Until))
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=DAILY;BYHOUR=24",
+		"FREQ=DAILY;COUNT=2;UNTIL=20200101",
+		"FREQ=DAILY;BYMONTH=1",
+		"FREQ",
+	} {
+		_, err := Parse(rule)
+		assert.Errorf(t, err, "rule %q", rule)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart string
+		from    string
+		to      string
+		want    []string
+	}{
+		{
+			name:    "weekly on dtstart weekday",
+			rule:    "FREQ=WEEKLY",
+			dtstart: "2020-01-07T22:00:00Z", // tuesday
+			from:    "2020-01-10T00:00:00Z",
+			to:      "2020-01-29T00:00:00Z",
+			want:    []string{"2020-01-14T22:00:00Z", "2020-01-21T22:00:00Z", "2020-01-28T22:00:00Z"},
+		},
+		{
+			name:    "weekly by day and hour with interval",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;BYHOUR=1,3",
+			dtstart: "2020-01-08T03:30:00Z", // wednesday
+			from:    "2020-01-01T00:00:00Z",
+			to:      "2020-01-23T00:00:00Z",
+			want:    []string{"2020-01-08T03:30:00Z", "2020-01-20T01:30:00Z", "2020-01-20T03:30:00Z", "2020-01-22T01:30:00Z", "2020-01-22T03:30:00Z"},
+		},
+		{
+			name:    "daily with count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: "2020-01-01T12:00:00Z",
+			from:    "2019-01-01T00:00:00Z",
+			to:      "2021-01-01T00:00:00Z",
+			want:    []string{"2020-01-01T12:00:00Z", "2020-01-02T12:00:00Z", "2020-01-03T12:00:00Z"},
+		},
+		{
+			name:    "daily on weekdays until",
+			rule:    "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;UNTIL=20200107T120000Z",
+			dtstart: "2020-01-03T12:00:00Z", // friday
+			from:    "2019-01-01T00:00:00Z",
+			to:      "2021-01-01T00:00:00Z",
+			want:    []string{"2020-01-03T12:00:00Z", "2020-01-06T12:00:00Z", "2020-01-07T12:00:00Z"},
+		},
+		{
+			name:    "hourly by hour",
+			rule:    "FREQ=HOURLY;INTERVAL=2;BYHOUR=2,3,4",
+			dtstart: "2020-01-01T00:15:00Z",
+			from:    "2020-01-01T00:00:00Z",
+			to:      "2020-01-02T03:00:00Z",
+			want:    []string{"2020-01-01T02:15:00Z", "2020-01-01T04:15:00Z", "2020-01-02T02:15:00Z"},
+		},
+		{
+			name:    "monthly skips months without day",
+			rule:    "FREQ=MONTHLY",
+			dtstart: "2020-01-31T00:00:00Z",
+			from:    "2020-01-01T00:00:00Z",
+			to:      "2020-06-01T00:00:00Z",
+			want:    []string{"2020-01-31T00:00:00Z", "2020-03-31T00:00:00Z", "2020-05-31T00:00:00Z"},
+		},
+		{
+			name:    "occurrence overlapping from is included",
+			rule:    "FREQ=DAILY",
+			dtstart: "2020-01-01T23:00:00Z",
+			from:    "2020-01-03T00:30:00Z",
+			to:      "2020-01-03T23:00:00Z",
+			want:    []string{"2020-01-02T23:00:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			require.NoError(t, err)
+			got := r.Between(mustTime(t, tt.dtstart), 2*time.Hour, mustTime(t, tt.from), mustTime(t, tt.to))
+			gotStr := make([]string, len(got))
+			for i := range got {
+				gotStr[i] = got[i].Format(time.RFC3339)
+			}
+			assert.Equal(t, tt.want, gotStr)
+		})
+	}
+}
+
+func TestLast(t *testing.T) {
+	r, err := Parse("FREQ=WEEKLY;BYDAY=MO,FR;COUNT=3")
+	require.NoError(t, err)
+	last, ok := r.Last(mustTime(t, "2020-01-06T10:00:00Z"))
+	assert.True(t, ok)
+	assert.Equal(t, "2020-01-13T10:00:00Z", last.Format(time.RFC3339))
+
+	r, err = Parse("FREQ=WEEKLY")
+	require.NoError(t, err)
+	_, ok = r.Last(mustTime(t, "2020-01-06T10:00:00Z"))
+	assert.False(t, ok)
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, s)
+	require.NoError(t, err)
+	return v
+}
@@ -0,0 +1,216 @@
+package report
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/api/query"
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+type Format string
+
+const (
+	FormatHTML     Format = "html"
+	FormatMarkdown Format = "markdown"
+)
+
+// ParseFormat returns the report format for "html", "markdown" or "md"
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "html":
+		return FormatHTML, nil
+	case "markdown", "md":
+		return FormatMarkdown, nil
+	}
+	return "", fmt.Errorf("unsupported report format %q, expected \"html\" or \"markdown\"", s)
+}
+
+// ContentType returns the media type of the rendered report
+func (f Format) ContentType() string {
+	if f == FormatMarkdown {
+		return "text/markdown; charset=utf-8"
+	}
+	return "text/html; charset=utf-8"
+}
+
+// Data is passed to the report templates
+type Data struct {
+	Cluster types.Cluster
+	Query   query.QueryClusterResponse
+	// Downtimes are the downtime windows matching the cluster within the reporting period
+	Downtimes   []types.DowntimeWindow
+	GeneratedAt time.Time
+}
+
+// Renderer renders reports from Go templates
+type Renderer struct {
+	html     *htmltemplate.Template
+	markdown *texttemplate.Template
+}
+
+// NewRenderer parses the given template files.
+// An empty path selects the built-in default template of the format.
+func NewRenderer(htmlTemplatePath, markdownTemplatePath string) (*Renderer, error) {
+	htmlTemplate, err := readTemplate(htmlTemplatePath, "templates/default.html.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	markdownTemplate, err := readTemplate(markdownTemplatePath, "templates/default.md.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Renderer{}
+	r.html, err = htmltemplate.New("html").Funcs(templateFuncs).Parse(htmlTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse HTML report template: %w", err)
+	}
+	r.markdown, err = texttemplate.New("markdown").Funcs(templateFuncs).Parse(markdownTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse Markdown report template: %w", err)
+	}
+	return r, nil
+}
+
+func readTemplate(path, defaultPath string) (string, error) {
+	var content []byte
+	var err error
+	if path == "" {
+		content, err = templateFS.ReadFile(defaultPath)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read report template: %w", err)
+	}
+	return string(content), nil
+}
+
+// Render writes the report in the given format
+func (r *Renderer) Render(w io.Writer, format Format, data Data) error {
+	var err error
+	switch format {
+	case FormatHTML:
+		err = r.html.Execute(w, data)
+	case FormatMarkdown:
+		err = r.markdown.Execute(w, data)
+	default:
+		return fmt.Errorf("unsupported report format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("could not render report: %w", err)
+	}
+	return nil
+}
+
+var templateFuncs = map[string]any{
+	"clusterName": clusterName,
+	"percent":     query.FormatPercent,
+	"hours":       query.FormatHours,
+	"achieved":    achieved,
+	"formatTime":  formatTime,
+	"markdown":    escapeMarkdown,
+	"markdownURL": escapeMarkdownURL,
+	"chart":       burnDownChart,
+}
+
+// clusterName returns the display name of the cluster, falling back to the cluster ID
+func clusterName(c types.Cluster) string {
+	if c.DisplayName != "" {
+		return c.DisplayName
+	}
+	return c.ID
+}
+
+// achieved returns the ratio of good events or time over the entire window
+func achieved(d query.QueryClusterResponseSLIData) float64 {
+	return 1 - d.ErrorRateWindow
+}
+
+// formatTime formats a time.Time or *time.Time, an unset time is formatted as "-"
+func formatTime(t any) string {
+	switch v := t.(type) {
+	case time.Time:
+		return v.Format("2006-01-02 15:04 MST")
+	case *time.Time:
+		if v != nil {
+			return v.Format("2006-01-02 15:04 MST")
+		}
+	}
+	return "-"
+}
+
+// burnDownChart returns the inline SVG burn-down chart of the SLO, see query.RenderBurnDownChart
+func burnDownChart(res query.QueryClusterResponse, slothID string) (htmltemplate.HTML, error) {
+	var b strings.Builder
+	if err := query.RenderBurnDownChart(&b, res, slothID); err != nil {
+		return "", err
+	}
+	return htmltemplate.HTML(b.String()), nil
+}
+
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "|", "\\|", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]", "`", "\\`", "\n", " ")
+
+// escapeMarkdown escapes text for use in Markdown tables
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+var markdownURLEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "[", "%5B", "]", "%5D", "<", "%3C", ">", "%3E", "|", "%7C", "\n", "")
+
+// escapeMarkdownURL percent-encodes the characters that end the destination of a Markdown link or a table cell
+func escapeMarkdownURL(s string) string {
+	return markdownURLEscaper.Replace(s)
+}
+
+// QueryClient queries the SLI data of a cluster, see query.Querier
+type QueryClient interface {
+	QueryCluster(ctx context.Context, clusterID string, params url.Values) (query.QueryClusterResponse, error)
+}
+
+type ClusterGetter interface {
+	GetCluster(ctx context.Context, clusterID string) (types.Cluster, error)
+}
+
+// Generator collects the data of cluster reports
+type Generator struct {
+	querier  QueryClient
+	clusters ClusterGetter
+	now      func() time.Time
+}
+
+func NewGenerator(querier QueryClient, clusters ClusterGetter) *Generator {
+	return &Generator{querier: querier, clusters: clusters, now: time.Now}
+}
+
+// ClusterData returns the report data of the cluster.
+// The parameters are the same as the query parameters of `GET /query/cluster/{clusterid}`.
+func (g *Generator) ClusterData(ctx context.Context, clusterID string, params url.Values) (Data, error) {
+	cluster, err := g.clusters.GetCluster(ctx, clusterID)
+	if err != nil {
+		return Data{}, fmt.Errorf("could not get cluster %q: %w", clusterID, err)
+	}
+	res, err := g.querier.QueryCluster(ctx, clusterID, params)
+	if err != nil {
+		return Data{}, err
+	}
+
+	return Data{
+		Cluster:     cluster,
+		Query:       res,
+		Downtimes:   res.Downtimes,
+		GeneratedAt: g.now().In(res.From.Location()),
+	}, nil
+}
@@ -0,0 +1,159 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/api/query"
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+func testData(t *testing.T) Data {
+	from, err := time.Parse(time.RFC3339, "2026-09-01T00:00:00Z")
+	require.NoError(t, err)
+	to := from.AddDate(0, 1, 0)
+	start := from.Add(48 * time.Hour)
+	end := start.Add(2 * time.Hour)
+	return Data{
+		Cluster: types.Cluster{ID: "c-cluster", DisplayName: "Production", Tenant: "t-acme"},
+		Query: query.QueryClusterResponse{
+			ClusterID: "c-cluster",
+			From:      from,
+			To:        to,
+			SLIData: map[string]query.QueryClusterResponseSLIData{
+				"ingress": {Objective: 0.999, ErrorRateWindow: 0.0005, ErrorBudgetRemainingWindow: 0.0005, ErrorBudgetRemainingWindowPercentage: 0.5},
+				"api":     {Objective: 0.99, ErrorRateWindow: 0.02, ErrorBudgetRemainingWindow: -0.01, ErrorBudgetRemainingWindowPercentage: -1, MissingHours: 3},
+			},
+		},
+		Downtimes: []types.DowntimeWindow{
+			{Title: "Upgrade | OpenShift 4.19", StartTime: &start, EndTime: &end, ExternalID: "CHG-1", ExternalLink: "https://example.com/CHG-1"},
+			{Title: "<script>", StartTime: &start},
+		},
+		GeneratedAt: to,
+	}
+}
+
+func TestRenderDefaultTemplates(t *testing.T) {
+	r, err := NewRenderer("", "")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Render(&buf, FormatMarkdown, testData(t)))
+	md := buf.String()
+	assert.Contains(t, md, "# SLA Report Production")
+	assert.Contains(t, md, "| Tenant | t-acme |")
+	assert.Contains(t, md, "| Period | 2026-09-01 00:00 UTC – 2026-10-01 00:00 UTC |")
+	assert.Contains(t, md, "| api | 99% | 98% | -100% | 3h |")
+	assert.Contains(t, md, "| ingress | 99.9% | 99.95% | 50% | 0h |")
+	assert.Contains(t, md, "| Upgrade \\| OpenShift 4.19 | 2026-09-03 00:00 UTC | 2026-09-03 02:00 UTC | [CHG-1](https://example.com/CHG-1) |")
+	assert.Contains(t, md, "| <script> | 2026-09-03 00:00 UTC | - |  |")
+
+	buf.Reset()
+	require.NoError(t, r.Render(&buf, FormatHTML, testData(t)))
+	html := buf.String()
+	assert.Contains(t, html, "<title>SLA Report Production</title>")
+	assert.Contains(t, html, `<tr class="violated"><td>api</td>`)
+	assert.Contains(t, html, `<a href="https://example.com/CHG-1">CHG-1</a>`)
+	assert.Contains(t, html, "&lt;script&gt;")
+	assert.Contains(t, html, `<h3>ingress</h3>
+<svg xmlns="http://www.w3.org/2000/svg"`)
+	assert.NotContains(t, html, "<script>")
+}
+
+func TestRenderMarkdownEscaping(t *testing.T) {
+	r, err := NewRenderer("", "")
+	require.NoError(t, err)
+
+	data := testData(t)
+	data.Query.SLIData = map[string]query.QueryClusterResponseSLIData{
+		"api_v2|beta": {Objective: 0.99, MissingHours: 2.4000000000000004},
+	}
+	data.Downtimes = []types.DowntimeWindow{
+		{Title: "Upgrade", StartTime: data.Downtimes[0].StartTime, ExternalID: "CHG-[2]", ExternalLink: "https://example.com/a b(1)]|x"},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, r.Render(&buf, FormatMarkdown, data))
+	md := buf.String()
+	assert.Contains(t, md, "| api\\_v2\\|beta | 99% | 100% | 0% | 2.4h |")
+	assert.Contains(t, md, "[CHG-\\[2\\]](https://example.com/a%20b%281%29%5D%7Cx)")
+
+	buf.Reset()
+	require.NoError(t, r.Render(&buf, FormatHTML, data))
+	assert.Contains(t, buf.String(), `<td class="number">2.4h</td>`)
+}
+
+func TestRenderCustomTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.md.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte(`{{ .Cluster.ID }}:{{ range $id, $d := .Query.SLIData }} {{ $id }}={{ percent (achieved $d) }}{{ end }}`), 0o644))
+
+	r, err := NewRenderer("", path)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, r.Render(&buf, FormatMarkdown, testData(t)))
+	assert.Equal(t, "c-cluster: api=98% ingress=99.95%", buf.String())
+
+	_, err = NewRenderer(filepath.Join(t.TempDir(), "missing"), "")
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{{ .Cluster.ID `), 0o644))
+	_, err = NewRenderer("", path)
+	assert.Error(t, err)
+}
+
+func TestParseFormat(t *testing.T) {
+	for s, expected := range map[string]Format{"html": FormatHTML, "HTML": FormatHTML, "markdown": FormatMarkdown, "md": FormatMarkdown} {
+		f, err := ParseFormat(s)
+		require.NoError(t, err)
+		assert.Equal(t, expected, f)
+	}
+	_, err := ParseFormat("pdf")
+	assert.Error(t, err)
+}
+
+type staticQueryClient struct {
+	response query.QueryClusterResponse
+	params   url.Values
+}
+
+func (s *staticQueryClient) QueryCluster(ctx context.Context, clusterID string, params url.Values) (query.QueryClusterResponse, error) {
+	s.params = params
+	return s.response, nil
+}
+
+type staticClusterGetter map[string]types.Cluster
+
+func (s staticClusterGetter) GetCluster(ctx context.Context, clusterID string) (types.Cluster, error) {
+	c, ok := s[clusterID]
+	if !ok {
+		return types.Cluster{}, types.ErrNotFound
+	}
+	return c, nil
+}
+
+func TestGeneratorClusterData(t *testing.T) {
+	data := testData(t)
+	res := data.Query
+	res.Downtimes = data.Downtimes
+	querier := &staticQueryClient{response: res}
+	g := NewGenerator(querier, staticClusterGetter{"c-cluster": data.Cluster})
+	g.now = func() time.Time { return data.GeneratedAt }
+
+	got, err := g.ClusterData(t.Context(), "c-cluster", url.Values{"period": {"2026-09"}})
+	require.NoError(t, err)
+	assert.Equal(t, data.Cluster, got.Cluster)
+	assert.Equal(t, data.Downtimes, got.Downtimes)
+	assert.Equal(t, data.GeneratedAt, got.GeneratedAt)
+	assert.Equal(t, "2026-09", querier.params.Get("period"))
+
+	_, err = g.ClusterData(t.Context(), "c-unknown", url.Values{})
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
@@ -0,0 +1,449 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/vshn-sli-reporting/pkg/audit"
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+// storeFactory returns a new, empty and uninitialized store
+type storeFactory func(t *testing.T, lieutenant Client) *downtimeStore
+
+func TestSQLiteConformance(t *testing.T) {
+	runConformanceSuite(t, func(t *testing.T, lieutenant Client) *downtimeStore {
+		store, err := NewDowntimeStore(":memory:", lieutenant)
+		require.NoError(t, err)
+		t.Cleanup(func() { store.CloseDB() })
+		return store
+	})
+}
+
+// runConformanceSuite checks the behavior every storage backend has to implement
+func runConformanceSuite(t *testing.T, newStore storeFactory) {
+	ts := func(s string) *time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return &v
+	}
+	initialized := func(t *testing.T, facts map[string]string) *downtimeStore {
+		store := newStore(t, &mockLieutenant{ReturnVal: facts})
+		require.NoError(t, store.InitializeDB())
+		return store
+	}
+
+	t.Run("migrations", func(t *testing.T) {
+		store := newStore(t, &mockLieutenant{})
+		latest, err := store.LatestSchemaVersion()
+		require.NoError(t, err)
+
+		assert.Error(t, store.VerifySchema(false))
+		require.NoError(t, store.VerifySchema(true))
+		v, err := store.SchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, latest, v)
+
+		require.NoError(t, store.MigrateDown(latest))
+		v, err = store.SchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, 0, v)
+
+		require.NoError(t, store.MigrateUp(0))
+		status, err := store.MigrationStatus()
+		require.NoError(t, err)
+		for _, s := range status {
+			assert.True(t, s.Applied)
+		}
+	})
+
+	t.Run("migrating duplicate external IDs", func(t *testing.T) {
+		store := newStore(t, &mockLieutenant{})
+		require.NoError(t, store.MigrateUp(5))
+		_, err := store.db.Exec(`INSERT INTO downtime (id, start_time, end_time, title, description, external_id, external_link, affects, deleted_at) VALUES
+		  ('w1', 0, 0, '', '', 'a', '', '[]', 100), ('w2', 0, 0, '', '', 'a', '', '[]', 0), ('w3', 0, 0, '', '', 'a', '', '[]', 0),
+		  ('w4', 0, 0, '', '', 'b', '', '[]', 0), ('w5', 0, 0, '', '', '', '', '[]', 0), ('w6', 0, 0, '', '', '', '', '[]', 0)`)
+		require.NoError(t, err)
+
+		require.NoError(t, store.MigrateUp(0))
+
+		// the first window that is not deleted keeps the external ID
+		externalIDs := map[string]string{}
+		for _, id := range []string{"w1", "w2", "w3", "w4", "w5", "w6"} {
+			w, err := store.GetWindow(id)
+			require.NoError(t, err, "duplicates are kept")
+			externalIDs[id] = w.ExternalID
+		}
+		assert.Equal(t, map[string]string{"w1": "", "w2": "a", "w3": "", "w4": "b", "w5": "", "w6": ""}, externalIDs)
+	})
+
+	t.Run("create, update and patch", func(t *testing.T) {
+		store := initialized(t, nil)
+
+		w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+			StartTime:    ts("2020-01-01T00:00:00Z"),
+			EndTime:      ts("2020-01-02T00:00:00Z"),
+			Title:        "Test1",
+			Description:  "desc",
+			ExternalID:   "a",
+			ExternalLink: "https://example.com",
+			Affects:      []types.AffectedClusterMatcher{{"foo": {Value: "bar"}}},
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, w.ID)
+
+		got, err := store.GetWindow(w.ID)
+		require.NoError(t, err)
+		assert.Equal(t, w, got)
+
+		// same external ID updates the existing window
+		w2, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+			StartTime:  ts("2020-01-01T00:00:00Z"),
+			EndTime:    ts("2020-01-03T00:00:00Z"),
+			Title:      "Test1",
+			ExternalID: "a",
+			Affects:    []types.AffectedClusterMatcher{},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, w.ID, w2.ID)
+
+		w3, err := store.UpdateWindow(context.TODO(), types.DowntimeWindow{
+			ID:         w.ID,
+			StartTime:  ts("2020-01-01T00:00:00Z"),
+			Title:      "Test2",
+			ExternalID: "a",
+			Affects:    []types.AffectedClusterMatcher{},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Test2", w3.Title)
+		assert.Nil(t, w3.EndTime)
+
+		w4, err := store.PatchWindow(context.TODO(), types.DowntimeWindow{ID: w.ID, Description: "patched"})
+		require.NoError(t, err)
+		assert.Equal(t, "Test2", w4.Title)
+		assert.Equal(t, "patched", w4.Description)
+
+		other, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+			StartTime:  ts("2020-01-01T00:00:00Z"),
+			Title:      "Other",
+			ExternalID: "b",
+			Affects:    []types.AffectedClusterMatcher{},
+		})
+		require.NoError(t, err)
+		_, err = store.PatchWindow(context.TODO(), types.DowntimeWindow{ID: other.ID, ExternalID: "a"})
+		assert.Error(t, err)
+
+		_, err = store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+			StartTime: ts("2020-01-02T00:00:00Z"),
+			EndTime:   ts("2020-01-01T00:00:00Z"),
+			Affects:   []types.AffectedClusterMatcher{},
+		})
+		assert.Error(t, err)
+
+		_, err = store.GetWindow("nope")
+		assert.ErrorIs(t, err, types.ErrNotFound)
+	})
+
+	t.Run("external ID is unique", func(t *testing.T) {
+		store := initialized(t, nil)
+		insert := store.db.Rebind(`INSERT INTO downtime (id, start_time, end_time, title, description, external_id, external_link, affects) VALUES (?, 0, 0, '', '', ?, '', '[]')`)
+
+		_, err := store.db.Exec(insert, "one", "a")
+		require.NoError(t, err)
+		_, err = store.db.Exec(insert, "two", "a")
+		assert.Error(t, err, "a window inserted concurrently with the same external ID is rejected")
+		_, err = store.db.Exec(insert, "three", "")
+		require.NoError(t, err)
+		_, err = store.db.Exec(insert, "four", "")
+		assert.NoError(t, err, "empty external IDs are not unique")
+
+		w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+			StartTime:  ts("2020-01-01T00:00:00Z"),
+			Title:      "Upserted",
+			ExternalID: "a",
+			Affects:    []types.AffectedClusterMatcher{},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "one", w.ID)
+		assert.Equal(t, "Upserted", w.Title)
+	})
+
+	t.Run("list and match", func(t *testing.T) {
+		store := initialized(t, map[string]string{"foo": "bar"})
+		for _, w := range []types.DowntimeWindow{
+			{Title: "Before", StartTime: ts("2019-01-01T00:00:00Z"), EndTime: ts("2019-01-02T00:00:00Z"), Affects: []types.AffectedClusterMatcher{{}}},
+			{Title: "Matching", StartTime: ts("2020-01-01T00:00:00Z"), EndTime: ts("2020-01-02T00:00:00Z"), Affects: []types.AffectedClusterMatcher{{"foo": {Value: "bar"}}}},
+			{Title: "NotMatching", StartTime: ts("2020-01-01T00:00:00Z"), EndTime: ts("2020-01-02T00:00:00Z"), Affects: []types.AffectedClusterMatcher{{"foo": {Value: "baz"}}}},
+			{Title: "Open", StartTime: ts("2019-06-01T00:00:00Z"), Affects: []types.AffectedClusterMatcher{{}}},
+			{Title: "Recurring", StartTime: ts("2019-12-30T22:00:00Z"), Affects: []types.AffectedClusterMatcher{{}},
+				Recurrence: &types.Recurrence{Rule: "FREQ=DAILY;COUNT=5", Duration: "1h"}},
+		} {
+			_, err := store.StoreNewWindow(context.TODO(), w)
+			require.NoError(t, err)
+		}
+
+		windows, err := store.ListWindows(*ts("2020-01-01T00:00:00Z"), *ts("2020-01-02T00:00:00Z"))
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"Matching", "NotMatching", "Open", "Recurring"}, titles(windows))
+
+		windows, err = store.ListWindowsMatchingClusterFacts(context.TODO(), *ts("2020-01-01T00:00:00Z"), *ts("2020-01-02T00:00:00Z"), "c-cluster")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"Matching", "Open", "Recurring"}, titles(windows))
+		for _, w := range windows {
+			if w.Title == "Recurring" {
+				assert.True(t, ts("2020-01-01T22:00:00Z").Equal(*w.StartTime))
+				assert.True(t, ts("2020-01-01T23:00:00Z").Equal(*w.EndTime))
+			}
+		}
+	})
+
+	t.Run("soft delete and restore", func(t *testing.T) {
+		store := initialized(t, nil)
+		w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+			Title:     "Test1",
+			StartTime: ts("2020-01-01T00:00:00Z"),
+			Affects:   []types.AffectedClusterMatcher{},
+		})
+		require.NoError(t, err)
+
+		d, err := store.DeleteWindow(context.TODO(), w.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, d.DeletedAt)
+
+		windows, err := store.ListWindows(*ts("2020-01-01T00:00:00Z"), *ts("2020-01-02T00:00:00Z"))
+		require.NoError(t, err)
+		assert.Empty(t, windows)
+		windows, err = store.ListWindowsIncludingDeleted(*ts("2020-01-01T00:00:00Z"), *ts("2020-01-02T00:00:00Z"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(windows))
+
+		_, err = store.PatchWindow(context.TODO(), types.DowntimeWindow{ID: w.ID, Title: "TestX"})
+		assert.Error(t, err)
+
+		r, err := store.RestoreWindow(context.TODO(), w.ID)
+		require.NoError(t, err)
+		assert.Nil(t, r.DeletedAt)
+		windows, err = store.ListWindows(*ts("2020-01-01T00:00:00Z"), *ts("2020-01-02T00:00:00Z"))
+		require.NoError(t, err)
+		assert.Equal(t, 1, len(windows))
+	})
+
+	t.Run("revisions", func(t *testing.T) {
+		store := initialized(t, map[string]string{})
+		ctx := audit.NewContext(context.TODO(), audit.Actor{User: "admin", RequestID: "req"})
+
+		setClock(store, "2021-01-01T00:00:00Z")
+		w, err := store.StoreNewWindow(ctx, types.DowntimeWindow{
+			Title:     "Test1",
+			StartTime: ts("2020-01-01T00:00:00Z"),
+			Affects:   []types.AffectedClusterMatcher{{}},
+		})
+		require.NoError(t, err)
+		setClock(store, "2021-01-02T00:00:00Z")
+		_, err = store.PatchWindow(ctx, types.DowntimeWindow{ID: w.ID, Title: "Test2"})
+		require.NoError(t, err)
+
+		revs, err := store.GetWindowHistory(w.ID)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(revs))
+		assert.Equal(t, "create", revs[0].Action)
+		assert.Equal(t, "admin", revs[0].User)
+		assert.Equal(t, "req", revs[0].RequestID)
+		assert.Equal(t, "Test1", revs[1].Before.Title)
+		assert.Equal(t, "Test2", revs[1].After.Title)
+
+		_, err = store.db.Exec("DELETE FROM downtime_revision")
+		assert.Error(t, err, "revisions must be immutable")
+
+		windows, err := store.ListWindowsMatchingClusterFactsAsOf(context.TODO(), *ts("2020-01-01T00:00:00Z"), *ts("2020-01-02T00:00:00Z"), "c-cluster", *ts("2021-01-01T12:00:00Z"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Test1"}, titles(windows))
+		windows, err = store.ListWindowsAsOf(*ts("2020-01-01T00:00:00Z"), *ts("2020-01-02T00:00:00Z"), *ts("2020-12-31T00:00:00Z"))
+		require.NoError(t, err)
+		assert.Empty(t, windows)
+	})
+
+	t.Run("cluster facts history", func(t *testing.T) {
+		lieutenant := clusterFacts{
+			"c-one": {"distribution": "openshift4"},
+			"c-two": {"distribution": "k8s"},
+		}
+		store := newStore(t, lieutenant)
+		require.NoError(t, store.InitializeDB())
+		ctx := context.TODO()
+
+		setClock(store, "2020-01-10T00:00:00Z")
+		require.NoError(t, store.SnapshotClusterFacts(ctx, lieutenant))
+		lieutenant["c-one"] = map[string]string{"distribution": "rancher"}
+		setClock(store, "2020-01-20T00:00:00Z")
+		require.NoError(t, store.SnapshotClusterFacts(ctx, lieutenant))
+		delete(lieutenant, "c-two")
+		setClock(store, "2020-01-30T00:00:00Z")
+		require.NoError(t, store.SnapshotClusterFacts(ctx, lieutenant))
+		setClock(store, "2020-02-01T00:00:00Z")
+		require.NoError(t, store.SnapshotClusterFacts(ctx, lieutenant))
+
+		history, err := store.GetClusterFactsHistory("c-one")
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, map[string]string{"distribution": "openshift4"}, history[0].Facts)
+		assert.True(t, ts("2020-01-10T00:00:00Z").Equal(history[0].ValidFrom))
+		require.NotNil(t, history[0].ValidTo)
+		assert.True(t, ts("2020-01-20T00:00:00Z").Equal(*history[0].ValidTo))
+		assert.Equal(t, map[string]string{"distribution": "rancher"}, history[1].Facts)
+		assert.Nil(t, history[1].ValidTo)
+		history, err = store.GetClusterFactsHistory("c-two")
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		require.NotNil(t, history[0].ValidTo)
+		assert.True(t, ts("2020-01-30T00:00:00Z").Equal(*history[0].ValidTo))
+
+		for _, w := range []struct{ title, start, end, distribution string }{
+			{"before history", "2020-01-05T00:00:00Z", "2020-01-06T00:00:00Z", "openshift4"},
+			{"openshift4", "2020-01-25T00:00:00Z", "2020-01-26T00:00:00Z", "openshift4"},
+			{"rancher", "2020-01-25T00:00:00Z", "2020-01-26T00:00:00Z", "rancher"},
+			{"overlapping change", "2020-01-15T00:00:00Z", "2020-01-25T00:00:00Z", "rancher"},
+			{"k8s", "2020-01-25T00:00:00Z", "2020-01-26T00:00:00Z", "k8s"},
+			{"k8s decommissioned", "2020-02-02T00:00:00Z", "2020-02-03T00:00:00Z", "k8s"},
+		} {
+			_, err := store.StoreNewWindow(ctx, types.DowntimeWindow{
+				Title:     w.title,
+				StartTime: ts(w.start),
+				EndTime:   ts(w.end),
+				Affects:   []types.AffectedClusterMatcher{{"distribution": {Value: w.distribution}}},
+			})
+			require.NoError(t, err)
+		}
+
+		windows, err := store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-one")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"before history", "rancher", "overlapping change"}, titles(windows))
+		windows, err = store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-two")
+		require.NoError(t, err, "decommissioned clusters are matched against their facts history")
+		assert.Equal(t, []string{"k8s"}, titles(windows))
+		windows, err = store.ListWindowsMatchingClusterFactsAsOf(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-two", *ts("2030-01-01T00:00:00Z"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"k8s"}, titles(windows))
+
+		_, err = store.db.Exec(store.db.Rebind("INSERT INTO cluster_facts_snapshot (cluster_id, facts, valid_from, valid_to) VALUES (?, '{}', 0, 0)"), "c-one")
+		assert.Error(t, err, "a cluster has at most one open snapshot")
+
+		lieutenant["c-new"] = map[string]string{"distribution": "k8s"}
+		windows, err = store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-new")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"k8s", "k8s decommissioned"}, titles(windows), "clusters without history are matched against their current facts")
+		_, err = store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-unknown")
+		assert.ErrorIs(t, err, types.ErrNotFound)
+	})
+
+	t.Run("cluster facts changed since the last snapshot", func(t *testing.T) {
+		lieutenant := clusterFacts{
+			"c-one": {"distribution": "openshift4"},
+			"c-two": {"distribution": "k8s"},
+		}
+		store := newStore(t, lieutenant)
+		require.NoError(t, store.InitializeDB())
+		ctx := context.TODO()
+
+		setClock(store, "2020-01-10T00:00:00Z")
+		require.NoError(t, store.SnapshotClusterFacts(ctx, lieutenant))
+		delete(lieutenant, "c-two")
+		setClock(store, "2020-01-20T00:00:00Z")
+		require.NoError(t, store.SnapshotClusterFacts(ctx, lieutenant))
+		// not snapshotted yet
+		lieutenant["c-one"] = map[string]string{"distribution": "rancher"}
+		lieutenant["c-two"] = map[string]string{"distribution": "rancher"}
+
+		for _, w := range []struct{ title, start, end, distribution string }{
+			{"openshift4", "2020-01-25T00:00:00Z", "2020-01-26T00:00:00Z", "openshift4"},
+			{"rancher", "2020-01-25T00:00:00Z", "2020-01-26T00:00:00Z", "rancher"},
+			{"rancher before", "2020-01-05T00:00:00Z", "2020-01-06T00:00:00Z", "rancher"},
+		} {
+			_, err := store.StoreNewWindow(ctx, types.DowntimeWindow{
+				Title:     w.title,
+				StartTime: ts(w.start),
+				EndTime:   ts(w.end),
+				Affects:   []types.AffectedClusterMatcher{{"distribution": {Value: w.distribution}}},
+			})
+			require.NoError(t, err)
+		}
+
+		windows, err := store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-one")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"openshift4", "rancher"}, titles(windows), "the open snapshot is valid until the facts changed, the current facts since")
+		windows, err = store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-two")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"rancher"}, titles(windows), "reappeared clusters are matched against their current facts since the last snapshot")
+	})
+
+	t.Run("cluster facts history without annotations and dynamic facts", func(t *testing.T) {
+		lieutenant := clusterFacts{
+			"c-one": {"distribution": "openshift4", "annotation:last-applied": "{...}", "dynamic_fact:kubernetesVersion": "1.33"},
+			"c-two": {"distribution": "k8s", "dynamic_fact:kubernetesVersion": "1.33"},
+		}
+		store := newStore(t, lieutenant)
+		require.NoError(t, store.InitializeDB())
+		ctx := context.TODO()
+
+		setClock(store, "2020-01-10T00:00:00Z")
+		require.NoError(t, store.SnapshotClusterFacts(ctx, lieutenant))
+		lieutenant["c-one"] = map[string]string{"distribution": "openshift4", "annotation:last-applied": "{.....}", "dynamic_fact:kubernetesVersion": "1.34"}
+		setClock(store, "2020-01-20T00:00:00Z")
+		require.NoError(t, store.SnapshotClusterFacts(ctx, lieutenant))
+
+		history, err := store.GetClusterFactsHistory("c-one")
+		require.NoError(t, err)
+		require.Len(t, history, 1, "changed annotations and dynamic facts should not store a new snapshot")
+		assert.Equal(t, map[string]string{"distribution": "openshift4"}, history[0].Facts)
+
+		_, err = store.StoreNewWindow(ctx, types.DowntimeWindow{
+			Title:     "upgrade",
+			StartTime: ts("2020-01-15T00:00:00Z"),
+			EndTime:   ts("2020-01-16T00:00:00Z"),
+			Affects:   []types.AffectedClusterMatcher{{"dynamic_fact:kubernetesVersion": {Value: "1.34"}}},
+		})
+		require.NoError(t, err)
+
+		windows, err := store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-one")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"upgrade"}, titles(windows), "dynamic facts are matched against their current value")
+		windows, err = store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-two")
+		require.NoError(t, err)
+		assert.Empty(t, windows)
+
+		delete(lieutenant, "c-one")
+		windows, err = store.ListWindowsMatchingClusterFacts(ctx, *ts("2020-01-01T00:00:00Z"), *ts("2020-03-01T00:00:00Z"), "c-one")
+		require.NoError(t, err, "decommissioned clusters have no dynamic facts")
+		assert.Empty(t, windows)
+	})
+}
+
+// clusterFacts is a Lieutenant client returning the facts of the clusters in the map
+type clusterFacts map[string]map[string]string
+
+func (c clusterFacts) GetClusterMatchContext(ctx context.Context, clusterID string) (map[string]string, error) {
+	facts, ok := c[clusterID]
+	if !ok {
+		return nil, fmt.Errorf("%w: cluster %q", types.ErrNotFound, clusterID)
+	}
+	return facts, nil
+}
+
+func (c clusterFacts) ListClusters(ctx context.Context, tenant string) ([]string, error) {
+	return slices.Sorted(maps.Keys(c)), nil
+}
+
+func titles(windows []types.DowntimeWindow) []string {
+	rv := make([]string, len(windows))
+	for i, w := range windows {
+		rv[i] = w.Title
+	}
+	return rv
+}
@@ -13,7 +13,7 @@ type mockLieutenant struct {
 	ReturnVal map[string]string
 }
 
-func (m *mockLieutenant) GetClusterFacts(ctx context.Context, clusterID string) (map[string]string, error) {
+func (m *mockLieutenant) GetClusterMatchContext(ctx context.Context, clusterID string) (map[string]string, error) {
 	return m.ReturnVal, nil
 }
 
@@ -43,63 +43,63 @@ func setupAndSeed(t *testing.T, facts map[string]string) *downtimeStore {
 	time5, _ := time.Parse(time.RFC3339, "2020-01-05T00:00:00Z")
 	time6, _ := time.Parse(time.RFC3339, "2020-01-06T00:00:00Z")
 	store.InitializeDB()
-	store.StoreNewWindow(types.DowntimeWindow{
+	store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime: &time1,
 		EndTime:   &time2,
 		Title:     "Test1",
 		Affects:   []types.AffectedClusterMatcher{}, // matches nothing
 	})
-	store.StoreNewWindow(types.DowntimeWindow{
+	store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime: &time2,
 		EndTime:   &time3,
 		Title:     "Test2",
 		Affects:   []types.AffectedClusterMatcher{types.AffectedClusterMatcher{}}, // matches all
 	})
-	store.StoreNewWindow(types.DowntimeWindow{
+	store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime: &time3,
 		EndTime:   &time4,
 		Title:     "Test3",
 		Affects: []types.AffectedClusterMatcher{
-			map[string]string{"foo": "bar"},
+			types.AffectedClusterMatcher{"foo": {Value: "bar"}},
 		},
 	})
-	store.StoreNewWindow(types.DowntimeWindow{
+	store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime: &time4,
 		EndTime:   &time5,
 		Title:     "Test4",
 		Affects: []types.AffectedClusterMatcher{
-			map[string]string{
-				"foo": "bar",
-				"baz": "quux",
+			types.AffectedClusterMatcher{
+				"foo": {Value: "bar"},
+				"baz": {Value: "quux"},
 			},
 		},
 	})
-	store.StoreNewWindow(types.DowntimeWindow{
+	store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime: &time5,
 		EndTime:   &time6,
 		Title:     "Test5",
 		Affects: []types.AffectedClusterMatcher{
-			map[string]string{
-				"foo": "bar",
+			types.AffectedClusterMatcher{
+				"foo": {Value: "bar"},
 			},
-			map[string]string{
-				"foo": "quack",
+			types.AffectedClusterMatcher{
+				"foo": {Value: "quack"},
 			},
 		},
 	})
-	store.StoreNewWindow(types.DowntimeWindow{
+	store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime: &time1,
 		// No end time
 		Title: "Test6",
 		Affects: []types.AffectedClusterMatcher{
-			map[string]string{
-				"foo": "box",
+			types.AffectedClusterMatcher{
+				"foo": {Value: "box"},
 			},
-			map[string]string{
-				"foo": "quack",
+			types.AffectedClusterMatcher{
+				"foo": {Value: "quack"},
 			},
-			map[string]string{
-				"du": "hans",
+			types.AffectedClusterMatcher{
+				"du": {Value: "hans"},
 			},
 		},
 	})
@@ -169,12 +169,106 @@ func TestListWindowsForCluster(t *testing.T) {
 
 }
 
+func TestListWindowsForClusterMatchOperators(t *testing.T) {
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
+
+	store := setup(t)
+	store.lieutenant = &mockLieutenant{ReturnVal: map[string]string{"distribution": "oke", "tenant": "t-a"}}
+	store.InitializeDB()
+
+	for title, m := range map[string]types.AffectedClusterMatcher{
+		"Regex":          {"distribution": {Op: types.MatchRegexp, Value: "openshift4|oke"}},
+		"RegexNoMatch":   {"distribution": {Op: types.MatchRegexp, Value: "openshift4"}},
+		"NotTenant":      {"tenant": {Op: types.MatchNotEqual, Value: "t-x"}},
+		"NotTenantMatch": {"tenant": {Op: types.MatchNotRegexp, Value: "t-a|t-b"}},
+		"In":             {"tenant": {Op: types.MatchIn, Values: []string{"t-a", "t-b"}}},
+		"NotExists":      {"maintenance": {Op: types.MatchNotExists}, "tenant": {Op: types.MatchExists}},
+		"Exists":         {"maintenance": {Op: types.MatchExists}},
+	} {
+		_, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+			StartTime: &time1,
+			EndTime:   &time2,
+			Title:     title,
+			Affects:   []types.AffectedClusterMatcher{m},
+		})
+		assert.NoError(t, err)
+	}
+
+	windows, err := store.ListWindowsMatchingClusterFacts(context.TODO(), time1, time2, "unused")
+	assert.NoError(t, err)
+	names := []string{}
+	for _, w := range windows {
+		names = append(names, w.Title)
+	}
+	assert.ElementsMatch(t, []string{"Regex", "NotTenant", "In", "NotExists"}, names)
+}
+
+func TestStoreNewWindowInvalidMatcher(t *testing.T) {
+	store := setup(t)
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	store.InitializeDB()
+	_, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime: &time1,
+		Title:     "Test1",
+		Affects: []types.AffectedClusterMatcher{
+			{"distribution": {Op: types.MatchRegexp, Value: "openshift4|(oke"}},
+		},
+	})
+	assert.ErrorContains(t, err, "invalid regular expression")
+
+	windows, err := store.ListWindows(time1, time1.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, windows)
+}
+
+func TestSLOSelector(t *testing.T) {
+	store := setup(t)
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	store.InitializeDB()
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime:   &time1,
+		Title:       "Test1",
+		Affects:     []types.AffectedClusterMatcher{},
+		SLOSelector: types.SLOSelector{"sloth_service": {Op: types.MatchRegexp, Value: "postgres|mysql"}},
+	})
+	assert.NoError(t, err)
+
+	got, err := store.GetWindow(w.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, types.MatchRegexp, got.SLOSelector["sloth_service"].Op)
+	assert.Equal(t, "postgres|mysql", got.SLOSelector["sloth_service"].Value)
+	assert.True(t, got.SLOSelector.Matches(map[string]string{"sloth_service": "mysql"}))
+
+	w2, err := store.PatchWindow(context.TODO(), types.DowntimeWindow{
+		ID:          w.ID,
+		SLOSelector: types.SLOSelector{"sloth_slo": {Value: "requests"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, types.SLOSelector{"sloth_slo": {Value: "requests"}}, w2.SLOSelector)
+
+	_, err = store.PatchWindow(context.TODO(), types.DowntimeWindow{
+		ID:          w.ID,
+		SLOSelector: types.SLOSelector{"cluster_id": {Value: "c-a"}},
+	})
+	assert.ErrorContains(t, err, "unsupported label")
+
+	w3, err := store.UpdateWindow(context.TODO(), types.DowntimeWindow{
+		ID:        w.ID,
+		StartTime: &time1,
+		Title:     "Test1",
+		Affects:   []types.AffectedClusterMatcher{},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, w3.SLOSelector)
+}
+
 func TestStoreNewWindow(t *testing.T) {
 	store := setup(t)
 	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
 	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
 	store.InitializeDB()
-	w, err := store.StoreNewWindow(types.DowntimeWindow{
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime:    &time1,
 		EndTime:      &time2,
 		Title:        "Test1",
@@ -201,7 +295,7 @@ func TestStoreNewWindowInvalid(t *testing.T) {
 	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
 	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
 	store.InitializeDB()
-	_, err := store.StoreNewWindow(types.DowntimeWindow{
+	_, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		// start time after end time
 		StartTime:    &time2,
 		EndTime:      &time1,
@@ -214,7 +308,7 @@ func TestStoreNewWindowInvalid(t *testing.T) {
 
 	assert.Error(t, err)
 
-	_, err = store.StoreNewWindow(types.DowntimeWindow{
+	_, err = store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		// no start time
 		EndTime:      &time1,
 		Title:        "Test1",
@@ -233,7 +327,7 @@ func TestStoreNewWindowWithSameExtId(t *testing.T) {
 	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
 	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
 	store.InitializeDB()
-	w, err := store.StoreNewWindow(types.DowntimeWindow{
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime:  &time1,
 		Title:      "Test1",
 		ExternalID: "a",
@@ -243,7 +337,7 @@ func TestStoreNewWindowWithSameExtId(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, w.ID)
 
-	w2, err := store.StoreNewWindow(types.DowntimeWindow{
+	w2, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime:  &time1,
 		EndTime:    &time2,
 		Title:      "Test1",
@@ -268,7 +362,7 @@ func TestUpdateWindow(t *testing.T) {
 	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
 	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
 	store.InitializeDB()
-	w, err := store.StoreNewWindow(types.DowntimeWindow{
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime:  &time1,
 		Title:      "Test1",
 		ExternalID: "a",
@@ -278,7 +372,7 @@ func TestUpdateWindow(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, w.ID)
 
-	w2, err := store.UpdateWindow(types.DowntimeWindow{
+	w2, err := store.UpdateWindow(context.TODO(), types.DowntimeWindow{
 		ID:          w.ID,
 		StartTime:   &time1,
 		EndTime:     &time2,
@@ -303,14 +397,14 @@ func TestUpdateFailsWithExtIdConflict(t *testing.T) {
 	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
 	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
 	store.InitializeDB()
-	_, err := store.StoreNewWindow(types.DowntimeWindow{
+	_, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime:  &time1,
 		Title:      "Test1",
 		ExternalID: "a",
 		Affects:    []types.AffectedClusterMatcher{},
 	})
 	assert.NoError(t, err)
-	w, err := store.StoreNewWindow(types.DowntimeWindow{
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime:  &time1,
 		Title:      "Test2",
 		ExternalID: "b",
@@ -319,7 +413,7 @@ func TestUpdateFailsWithExtIdConflict(t *testing.T) {
 
 	assert.NoError(t, err)
 
-	_, err = store.UpdateWindow(types.DowntimeWindow{
+	_, err = store.UpdateWindow(context.TODO(), types.DowntimeWindow{
 		ID:         w.ID,
 		StartTime:  &time1,
 		EndTime:    &time2,
@@ -334,7 +428,7 @@ func TestPatchWindow(t *testing.T) {
 	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
 	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
 	store.InitializeDB()
-	w, err := store.StoreNewWindow(types.DowntimeWindow{
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
 		StartTime:   &time1,
 		EndTime:     &time2,
 		Title:       "Test1",
@@ -345,12 +439,12 @@ func TestPatchWindow(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, w.ID)
 
-	w2, err := store.PatchWindow(types.DowntimeWindow{
+	w2, err := store.PatchWindow(context.TODO(), types.DowntimeWindow{
 		ID:         w.ID,
 		Title:      "TestX",
 		ExternalID: "a",
 		Affects: []types.AffectedClusterMatcher{
-			map[string]string{"baz": "quux"},
+			types.AffectedClusterMatcher{"baz": {Value: "quux"}},
 		},
 	})
 	assert.NoError(t, err)
@@ -367,3 +461,215 @@ func TestPatchWindow(t *testing.T) {
 	assert.Equal(t, 1, len(windows))
 
 }
+
+func TestRecurringWindow(t *testing.T) {
+	store := setupAndSeed(t, map[string]string{"foo": "bar"})
+	time1, _ := time.Parse(time.RFC3339, "2020-02-04T22:00:00Z") // tuesday
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime: &time1,
+		Title:     "Weekly",
+		Affects: []types.AffectedClusterMatcher{
+			types.AffectedClusterMatcher{"foo": {Value: "bar"}},
+		},
+		Recurrence: &types.Recurrence{
+			Rule:     "FREQ=WEEKLY;BYDAY=TU;COUNT=3",
+			Duration: "4h",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, w.EndTime)
+	assert.Equal(t, "4h0m0s", w.Recurrence.Duration)
+
+	from, _ := time.Parse(time.RFC3339, "2020-02-05T01:00:00Z")
+	to, _ := time.Parse(time.RFC3339, "2020-03-01T00:00:00Z")
+	windows, err := store.ListWindowsMatchingClusterFacts(context.TODO(), from, to, "unused")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(windows))
+
+	starts := make([]string, len(windows))
+	for i, w := range windows {
+		assert.Equal(t, "Weekly", w.Title)
+		assert.Equal(t, 4*time.Hour, w.EndTime.Sub(*w.StartTime))
+		starts[i] = w.StartTime.Format(time.RFC3339)
+	}
+	assert.Equal(t, []string{"2020-02-04T22:00:00Z", "2020-02-11T22:00:00Z", "2020-02-18T22:00:00Z"}, starts)
+
+	// occurrences keep the ID of the series but don't share their recurrence
+	assert.Equal(t, w.ID, windows[0].ID)
+	assert.Equal(t, w.ID, windows[1].ID)
+	assert.NotSame(t, windows[0].Recurrence, windows[1].Recurrence)
+	windows[0].Recurrence.Duration = "1h"
+	assert.Equal(t, "4h0m0s", windows[1].Recurrence.Duration)
+
+	// the series ends with the last occurrence
+	from, _ = time.Parse(time.RFC3339, "2020-02-19T02:00:00Z")
+	windows, err = store.ListWindows(from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(windows))
+	assert.Equal(t, "Test6", windows[0].Title)
+}
+
+func TestInitializeDBAddsMissingColumns(t *testing.T) {
+	store := setup(t)
+	// schema of databases created before recurring windows existed
+	_, err := store.db.Exec(`CREATE TABLE downtime (
+	  "id" TEXT PRIMARY KEY,
+	  "start_time" INTEGER NOT NULL,
+	  "end_time" INTEGER,
+	  "title" TEXT,
+	  "description" TEXT,
+	  "external_id" TEXT,
+	  "external_link" TEXT,
+	  "affects" TEXT
+	)`)
+	assert.NoError(t, err)
+	assert.NoError(t, store.InitializeDB())
+	assert.NoError(t, store.InitializeDB(), "initializing an up-to-date database is a no-op")
+
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	_, err = store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime:  &time1,
+		Title:      "Recurring",
+		Affects:    []types.AffectedClusterMatcher{},
+		Recurrence: &types.Recurrence{Rule: "FREQ=DAILY;COUNT=2", Duration: "1h"},
+	})
+	assert.NoError(t, err)
+}
+
+func TestRecurringWindowInvalid(t *testing.T) {
+	store := setup(t)
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
+	store.InitializeDB()
+
+	for _, w := range []types.DowntimeWindow{
+		{
+			StartTime:  &time1,
+			Recurrence: &types.Recurrence{Rule: "FREQ=SECONDLY", Duration: "1h"},
+		},
+		{
+			StartTime:  &time1,
+			Recurrence: &types.Recurrence{Rule: "FREQ=DAILY", Duration: "bogus"},
+		},
+		{
+			StartTime:  &time1,
+			Recurrence: &types.Recurrence{Rule: "FREQ=DAILY", Duration: "-1h"},
+		},
+		{
+			StartTime:  &time1,
+			EndTime:    &time2,
+			Recurrence: &types.Recurrence{Rule: "FREQ=DAILY", Duration: "1h"},
+		},
+	} {
+		w.Affects = []types.AffectedClusterMatcher{}
+		_, err := store.StoreNewWindow(context.TODO(), w)
+		assert.Error(t, err)
+	}
+}
+
+func TestDeleteAndRestoreWindow(t *testing.T) {
+	store := setup(t)
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
+	store.InitializeDB()
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime:  &time1,
+		EndTime:    &time2,
+		Title:      "Test1",
+		ExternalID: "a",
+		Affects:    []types.AffectedClusterMatcher{},
+	})
+	assert.NoError(t, err)
+
+	w2, err := store.DeleteWindow(context.TODO(), w.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, w2.DeletedAt)
+
+	windows, err := store.ListWindows(time1, time2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(windows))
+
+	windows, err = store.ListWindowsIncludingDeleted(time1, time2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(windows))
+	assert.NotNil(t, windows[0].DeletedAt)
+
+	w3, err := store.GetWindow(w.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, w2, w3)
+
+	_, err = store.PatchWindow(context.TODO(), types.DowntimeWindow{ID: w.ID, Title: "TestX"})
+	assert.Error(t, err)
+	_, err = store.UpdateWindow(context.TODO(), types.DowntimeWindow{ID: w.ID, StartTime: &time1, Title: "TestX"})
+	assert.Error(t, err)
+
+	w4, err := store.RestoreWindow(context.TODO(), w.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, w4.DeletedAt)
+	assert.Equal(t, w, w4)
+
+	windows, err = store.ListWindows(time1, time2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(windows))
+}
+
+func TestStoreNewWindowConflictsWithDeletedExtId(t *testing.T) {
+	store := setup(t)
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
+	store.InitializeDB()
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime:  &time1,
+		Title:      "Test1",
+		ExternalID: "a",
+		Affects:    []types.AffectedClusterMatcher{},
+	})
+	assert.NoError(t, err)
+	_, err = store.DeleteWindow(context.TODO(), w.ID)
+	assert.NoError(t, err)
+
+	// a deleted window is not revived by creating a window with its external ID
+	_, err = store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime:  &time1,
+		EndTime:    &time2,
+		Title:      "Test1",
+		ExternalID: "a",
+		Affects:    []types.AffectedClusterMatcher{},
+	})
+	assert.ErrorIs(t, err, types.ErrConflict)
+
+	windows, err := store.ListWindows(time1, time2)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(windows))
+	deleted, err := store.GetWindow(w.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+	assert.Nil(t, deleted.EndTime)
+
+	_, err = store.RestoreWindow(context.TODO(), w.ID)
+	assert.NoError(t, err)
+	w2, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime:  &time1,
+		EndTime:    &time2,
+		Title:      "Test1",
+		ExternalID: "a",
+		Affects:    []types.AffectedClusterMatcher{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, w.ID, w2.ID)
+	assert.True(t, time2.Equal(*w2.EndTime))
+}
+
+func TestWindowNotFound(t *testing.T) {
+	store := setup(t)
+	store.InitializeDB()
+
+	_, err := store.GetWindow("nope")
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	_, err = store.DeleteWindow(context.TODO(), "nope")
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	_, err = store.RestoreWindow(context.TODO(), "nope")
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	_, err = store.PatchWindow(context.TODO(), types.DowntimeWindow{ID: "nope"})
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
@@ -0,0 +1,234 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+type dbClusterFactsSnapshot struct {
+	ID        int64  `db:"id"`
+	ClusterID string `db:"cluster_id"`
+	Facts     string `db:"facts"`
+	ValidFrom int64  `db:"valid_from"`
+	ValidTo   int64  `db:"valid_to"`
+}
+
+// ClusterLister lists the IDs of the clusters, or only of the clusters of the given tenant if tenant is not empty
+type ClusterLister interface {
+	ListClusters(ctx context.Context, tenant string) ([]string, error)
+}
+
+// SnapshotClusterFacts records the current facts of all clusters.
+// The match context is recorded, so the history also covers the tenant, labels and display name, see types.Cluster.MatchContext.
+// Annotations and dynamic facts are left out, see volatileMatchKey.
+// A new snapshot is only stored if the facts of a cluster changed, the previous snapshot is valid until then.
+// The snapshots of clusters that no longer exist are closed.
+// Clusters whose facts cannot be retrieved keep their current snapshot.
+func (s *downtimeStore) SnapshotClusterFacts(ctx context.Context, clusters ClusterLister) error {
+	ids, err := clusters.ListClusters(ctx, "")
+	if err != nil {
+		return fmt.Errorf("unable to list clusters: %w", err)
+	}
+
+	var errs []error
+	listed := map[string]bool{}
+	current := map[string]string{}
+	for _, id := range ids {
+		listed[id] = true
+		facts, err := s.lieutenant.GetClusterMatchContext(ctx, id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to get facts for cluster %q: %w", id, err))
+			continue
+		}
+		serialized, err := serializeFacts(withoutVolatileFacts(facts))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to serialize facts of cluster %q: %w", id, err))
+			continue
+		}
+		current[id] = serialized
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	open := []dbClusterFactsSnapshot{}
+	err = tx.Select(&open, "SELECT * FROM cluster_facts_snapshot WHERE valid_to = 0")
+	if err != nil {
+		return fmt.Errorf("error while querying cluster facts snapshots: %w", err)
+	}
+
+	now := s.now().Unix()
+	closeQ := tx.Rebind("UPDATE cluster_facts_snapshot SET valid_to = ? WHERE id = ?")
+	for _, o := range open {
+		facts, ok := current[o.ClusterID]
+		if ok && facts == o.Facts {
+			delete(current, o.ClusterID)
+			continue
+		}
+		if !ok && listed[o.ClusterID] {
+			continue
+		}
+		if _, err := tx.Exec(closeQ, now, o.ID); err != nil {
+			return fmt.Errorf("unable to close facts snapshot of cluster %q: %w", o.ClusterID, err)
+		}
+	}
+
+	// another replica may have stored the snapshot concurrently, there is at most one open snapshot per cluster
+	insertQ := `INSERT INTO cluster_facts_snapshot (cluster_id, facts, valid_from, valid_to) VALUES (:cluster_id, :facts, :valid_from, :valid_to)
+	  ON CONFLICT (cluster_id) WHERE valid_to = 0 DO NOTHING`
+	for id, facts := range current {
+		_, err := tx.NamedExec(insertQ, dbClusterFactsSnapshot{ClusterID: id, Facts: facts, ValidFrom: now})
+		if err != nil {
+			return fmt.Errorf("unable to store facts snapshot of cluster %q: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return errors.Join(errs...)
+}
+
+// GetClusterFactsHistory returns the recorded facts snapshots of the cluster, oldest first
+func (s *downtimeStore) GetClusterFactsHistory(clusterId string) ([]types.ClusterFactsSnapshot, error) {
+	results := []dbClusterFactsSnapshot{}
+	err := s.db.Select(&results, s.db.Rebind("SELECT * FROM cluster_facts_snapshot WHERE cluster_id = ? ORDER BY valid_from, id"), clusterId)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying cluster facts snapshots: %w", err)
+	}
+
+	history := make([]types.ClusterFactsSnapshot, len(results))
+	for i, r := range results {
+		snapshot := types.ClusterFactsSnapshot{
+			ClusterID: r.ClusterID,
+			ValidFrom: time.Unix(r.ValidFrom, 0).UTC(),
+		}
+		if err := json.Unmarshal([]byte(r.Facts), &snapshot.Facts); err != nil {
+			return nil, fmt.Errorf("could not parse facts snapshot of cluster %q: %w", clusterId, err)
+		}
+		if r.ValidTo > 0 {
+			validTo := time.Unix(r.ValidTo, 0).UTC()
+			snapshot.ValidTo = &validTo
+		}
+		history[i] = snapshot
+	}
+	return history, nil
+}
+
+// matchClusterWindows returns the windows matching the facts the cluster had during the window.
+// The facts snapshots cover the past, the current facts cover the time since the last snapshot, see withCurrentFacts.
+// Clusters without recorded facts snapshots are matched against their current facts.
+func (s *downtimeStore) matchClusterWindows(ctx context.Context, windows []types.DowntimeWindow, clusterId string) ([]types.DowntimeWindow, error) {
+	history, err := s.GetClusterFactsHistory(clusterId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get facts history of cluster %q: %w", clusterId, err)
+	}
+	current, err := s.lieutenant.GetClusterMatchContext(ctx, clusterId)
+	// clusters that no longer exist are matched against their history only
+	removed := apierrors.IsNotFound(err) || errors.Is(err, types.ErrNotFound)
+	if err != nil && (!removed || len(history) == 0) {
+		return nil, fmt.Errorf("unable to get facts for cluster %q: %w", clusterId, err)
+	}
+	if len(history) == 0 {
+		return matchWindows(windows, current), nil
+	}
+	if !removed {
+		history = withCurrentFacts(history, current)
+	}
+
+	matchedWindows := make([]types.DowntimeWindow, 0)
+	for _, w := range windows {
+		if windowMatchesFactsHistory(w, history) {
+			matchedWindows = append(matchedWindows, w)
+		}
+	}
+	return matchedWindows, nil
+}
+
+// volatileMatchKey returns true for the keys of the match context that are not recorded in facts snapshots.
+// Annotations can be large, e.g. kubectl's last-applied-configuration, and dynamic facts change constantly.
+// Both would close and store a snapshot on nearly every run.
+func volatileMatchKey(key string) bool {
+	return strings.HasPrefix(key, types.MatchKeyAnnotationPrefix) || strings.HasPrefix(key, types.MatchKeyDynamicFactPrefix)
+}
+
+// withCurrentFacts adds the current facts of the cluster to the history.
+// The current annotations and dynamic facts are added to all snapshots, as they have no history.
+// The facts may have changed since the last snapshot was recorded, so the current facts are valid
+// from the start of the open snapshot, or from the end of the last snapshot if the cluster reappeared.
+func withCurrentFacts(history []types.ClusterFactsSnapshot, current map[string]string) []types.ClusterFactsSnapshot {
+	extended := make([]types.ClusterFactsSnapshot, len(history), len(history)+1)
+	for i, snapshot := range history {
+		facts := make(map[string]string, len(snapshot.Facts)+len(current))
+		maps.Copy(facts, snapshot.Facts)
+		for k, v := range current {
+			if volatileMatchKey(k) {
+				facts[k] = v
+			}
+		}
+		snapshot.Facts = facts
+		extended[i] = snapshot
+	}
+
+	last := history[len(history)-1]
+	if last.ValidTo == nil && maps.Equal(last.Facts, withoutVolatileFacts(current)) {
+		return extended
+	}
+	validFrom := last.ValidFrom
+	if last.ValidTo != nil {
+		validFrom = *last.ValidTo
+	}
+	return append(extended, types.ClusterFactsSnapshot{ClusterID: last.ClusterID, Facts: current, ValidFrom: validFrom})
+}
+
+// withoutVolatileFacts returns a copy of the match context without the keys that are not recorded in facts snapshots
+func withoutVolatileFacts(facts map[string]string) map[string]string {
+	filtered := make(map[string]string, len(facts))
+	for k, v := range facts {
+		if !volatileMatchKey(k) {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// windowMatchesFactsHistory returns true if the window matches any facts snapshot valid during the window.
+// The first snapshot is assumed to be valid since before the history was recorded.
+// Windows without end time extend to the current snapshot.
+func windowMatchesFactsHistory(w types.DowntimeWindow, history []types.ClusterFactsSnapshot) bool {
+	for i, snapshot := range history {
+		if i > 0 && w.EndTime != nil && !w.EndTime.After(snapshot.ValidFrom) {
+			continue
+		}
+		if snapshot.ValidTo != nil && w.StartTime != nil && !w.StartTime.Before(*snapshot.ValidTo) {
+			continue
+		}
+		if windowMatchesClusterFacts(w, snapshot.Facts) {
+			return true
+		}
+	}
+	return false
+}
+
+// serializeFacts returns the facts as JSON with sorted keys, so equal facts result in equal strings
+func serializeFacts(facts map[string]string) (string, error) {
+	if facts == nil {
+		facts = map[string]string{}
+	}
+	b, err := json.Marshal(facts)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
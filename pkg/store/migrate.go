@@ -0,0 +1,268 @@
+package store
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFS embed.FS
+
+// migrationLockID is the PostgreSQL advisory lock key held while applying migrations
+const migrationLockID = 7346258411
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+type dbSchemaMigration struct {
+	Version   int    `db:"version"`
+	Name      string `db:"name"`
+	AppliedAt int64  `db:"applied_at"`
+}
+
+// loadMigrations reads the ordered migrations from `migrations/<dialect>`.
+// Migration files are named `<version>_<name>.up.sql` and `<version>_<name>.down.sql`.
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %w", err)
+	}
+
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+		v, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", e.Name(), err)
+		}
+		content, err := fs.ReadFile(migrationFS, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %q: %w", e.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d is missing its up or down script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b migration) int { return a.Version - b.Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations are not consecutive, expected version %d, got %d", i+1, m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestSchemaVersion returns the schema version this binary expects
+func (s *downtimeStore) LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+// SchemaVersion returns the version of the database schema, 0 for an empty database
+func (s *downtimeStore) SchemaVersion() (int, error) {
+	if err := s.ensureMigrationTable(); err != nil {
+		return 0, err
+	}
+	var version int
+	err := s.db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	if err != nil {
+		return 0, fmt.Errorf("could not query schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrationStatus returns all known migrations and whether they have been applied
+func (s *downtimeStore) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationTable(); err != nil {
+		return nil, err
+	}
+	applied := []dbSchemaMigration{}
+	err = s.db.Select(&applied, "SELECT * FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("could not query applied migrations: %w", err)
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		status[i] = MigrationStatus{Version: m.Version, Name: m.Name}
+		for _, a := range applied {
+			if a.Version == m.Version {
+				at := time.Unix(a.AppliedAt, 0).UTC()
+				status[i].Applied = true
+				status[i].AppliedAt = &at
+			}
+		}
+	}
+	return status, nil
+}
+
+// MigrateUp applies all pending migrations up to and including version `target`.
+// A target of 0 applies all pending migrations.
+func (s *downtimeStore) MigrateUp(target int) error {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+	if target <= 0 || target > len(migrations) {
+		target = len(migrations)
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than the latest known migration %d", current, len(migrations))
+	}
+
+	for _, m := range migrations[min(current, target):target] {
+		err := s.applyMigration(m, true)
+		if err != nil {
+			return fmt.Errorf("could not apply migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the last `steps` applied migrations
+func (s *downtimeStore) MigrateDown(steps int) error {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than the latest known migration %d", current, len(migrations))
+	}
+
+	for i := current; i > 0 && i > current-steps; i-- {
+		m := migrations[i-1]
+		err := s.applyMigration(m, false)
+		if err != nil {
+			return fmt.Errorf("could not revert migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs the up or down script of the migration and records the change in schema_migrations in a single transaction.
+// On PostgreSQL the transaction holds an advisory lock, so replicas migrating concurrently wait for each other
+// and skip migrations that have been applied or reverted in the meantime.
+func (s *downtimeStore) applyMigration(m migration, up bool) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if s.dialect == "postgres" {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("could not lock migrations: %w", err)
+		}
+	}
+	var applied bool
+	err = tx.Get(&applied, tx.Rebind("SELECT COUNT(*) > 0 FROM schema_migrations WHERE version = ?"), m.Version)
+	if err != nil {
+		return fmt.Errorf("could not query applied migrations: %w", err)
+	}
+	if applied == up {
+		return nil
+	}
+
+	script, record, args := m.Down, "DELETE FROM schema_migrations WHERE version = ?", []any{m.Version}
+	if up {
+		script, record, args = m.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", []any{m.Version, m.Name, s.now().Unix()}
+	}
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(tx.Rebind(record), args...); err != nil {
+		return fmt.Errorf("could not record migration: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *downtimeStore) ensureMigrationTable() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	  "version" INTEGER PRIMARY KEY,
+	  "name" TEXT NOT NULL,
+	  "applied_at" BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("could not create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// VerifySchema returns an error if the database schema does not match the version expected by this binary.
+// If autoMigrate is set, pending migrations are applied instead.
+func (s *downtimeStore) VerifySchema(autoMigrate bool) error {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latest, err := s.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than the version %d supported by this binary", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+	if !autoMigrate {
+		return fmt.Errorf("database schema version %d does not match expected version %d, run `db migrate up` or enable auto migration", current, latest)
+	}
+	return s.MigrateUp(latest)
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations("sqlite")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+
+	_, err = loadMigrations("bogus")
+	assert.Error(t, err)
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	store := setup(t)
+	latest, err := store.LatestSchemaVersion()
+	require.NoError(t, err)
+
+	v, err := store.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 0, v)
+	assert.Error(t, store.VerifySchema(false))
+
+	require.NoError(t, store.MigrateUp(1))
+	v, err = store.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	status, err := store.MigrationStatus()
+	require.NoError(t, err)
+	require.Equal(t, latest, len(status))
+	assert.True(t, status[0].Applied)
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.False(t, status[1].Applied)
+
+	require.NoError(t, store.VerifySchema(true))
+	v, err = store.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, latest, v)
+	assert.NoError(t, store.VerifySchema(false))
+
+	// migrating up again is a no-op
+	require.NoError(t, store.MigrateUp(0))
+
+	require.NoError(t, store.MigrateDown(latest))
+	v, err = store.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 0, v)
+
+	_, err = store.db.Exec("SELECT * FROM downtime")
+	assert.Error(t, err, "downtime table should be removed")
+}
+
+func TestApplyMigrationSkipsAppliedMigrations(t *testing.T) {
+	store := setup(t)
+	migrations, err := loadMigrations("sqlite")
+	require.NoError(t, err)
+	require.NoError(t, store.MigrateUp(0))
+
+	// another replica applied the migrations after this one read the schema version
+	last := migrations[len(migrations)-1]
+	assert.NoError(t, store.applyMigration(last, true))
+	require.NoError(t, store.MigrateDown(1))
+	assert.NoError(t, store.applyMigration(last, false))
+
+	v, err := store.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations)-1, v)
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	store := setup(t)
+	// schema created by `db init` before migrations existed
+	_, err := store.db.Exec(`CREATE TABLE downtime (
+	  "id" TEXT PRIMARY KEY,
+	  "start_time" INTEGER NOT NULL,
+	  "end_time" INTEGER,
+	  "title" TEXT,
+	  "description" TEXT,
+	  "external_id" TEXT,
+	  "external_link" TEXT,
+	  "affects" TEXT
+	)`)
+	require.NoError(t, err)
+	_, err = store.db.Exec(`INSERT INTO downtime VALUES ('old', 1577836800, 1577923200, 'Old', '', '', '', '[]')`)
+	require.NoError(t, err)
+
+	require.NoError(t, store.InitializeDB())
+
+	w, err := store.GetWindow("old")
+	require.NoError(t, err)
+	assert.Equal(t, "Old", w.Title)
+	assert.Nil(t, w.DeletedAt)
+	assert.Nil(t, w.Recurrence)
+}
+
+func TestMigrateDuplicateOpenFactsSnapshots(t *testing.T) {
+	store := setup(t)
+	require.NoError(t, store.MigrateUp(6))
+	_, err := store.db.Exec(`INSERT INTO cluster_facts_snapshot (cluster_id, facts, valid_from, valid_to) VALUES
+	  ('c-one', '{"a":"1"}', 100, 0), ('c-one', '{"a":"2"}', 100, 0), ('c-two', '{}', 100, 0)`)
+	require.NoError(t, err)
+
+	require.NoError(t, store.MigrateUp(0))
+
+	history, err := store.GetClusterFactsHistory("c-one")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.NotNil(t, history[0].ValidTo)
+	assert.Nil(t, history[1].ValidTo)
+	assert.Equal(t, map[string]string{"a": "2"}, history[1].Facts)
+	history, err = store.GetClusterFactsHistory("c-two")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Nil(t, history[0].ValidTo)
+}
+
+func TestVerifySchemaNewerDatabase(t *testing.T) {
+	store := setup(t)
+	require.NoError(t, store.InitializeDB())
+	_, err := store.db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', 0)")
+	require.NoError(t, err)
+
+	assert.Error(t, store.VerifySchema(true))
+	assert.Error(t, store.MigrateUp(0))
+}
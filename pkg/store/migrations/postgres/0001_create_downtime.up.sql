@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS downtime (
+  "id" TEXT PRIMARY KEY,
+  "start_time" BIGINT NOT NULL,
+  "end_time" BIGINT,
+  "title" TEXT,
+  "description" TEXT,
+  "external_id" TEXT,
+  "external_link" TEXT,
+  "affects" TEXT
+);
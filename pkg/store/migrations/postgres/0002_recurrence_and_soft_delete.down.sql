@@ -0,0 +1,3 @@
+ALTER TABLE downtime DROP COLUMN "deleted_at";
+ALTER TABLE downtime DROP COLUMN "duration";
+ALTER TABLE downtime DROP COLUMN "rrule";
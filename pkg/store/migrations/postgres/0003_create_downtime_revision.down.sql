@@ -0,0 +1,2 @@
+DROP TABLE downtime_revision;
+DROP FUNCTION downtime_revision_immutable();
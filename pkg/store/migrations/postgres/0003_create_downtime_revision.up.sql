@@ -0,0 +1,22 @@
+CREATE TABLE downtime_revision (
+  "id" BIGSERIAL PRIMARY KEY,
+  "window_id" TEXT NOT NULL,
+  "action" TEXT NOT NULL,
+  "created_at" BIGINT NOT NULL,
+  "actor" TEXT NOT NULL DEFAULT '',
+  "request_id" TEXT NOT NULL DEFAULT '',
+  "internal_request_id" TEXT NOT NULL DEFAULT '',
+  "before_state" TEXT,
+  "after_state" TEXT NOT NULL
+);
+
+CREATE INDEX downtime_revision_window_id ON downtime_revision (window_id);
+
+CREATE FUNCTION downtime_revision_immutable() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'downtime revisions are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER downtime_revision_immutable BEFORE UPDATE OR DELETE ON downtime_revision
+FOR EACH ROW EXECUTE FUNCTION downtime_revision_immutable();
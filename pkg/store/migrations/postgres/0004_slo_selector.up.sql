@@ -0,0 +1 @@
+ALTER TABLE downtime ADD COLUMN "slo_selector" TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+CREATE TABLE cluster_facts_snapshot (
+  "id" BIGSERIAL PRIMARY KEY,
+  "cluster_id" TEXT NOT NULL,
+  "facts" TEXT NOT NULL,
+  "valid_from" BIGINT NOT NULL,
+  "valid_to" BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX cluster_facts_snapshot_cluster_id ON cluster_facts_snapshot (cluster_id);
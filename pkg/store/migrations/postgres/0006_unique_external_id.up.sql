@@ -0,0 +1,8 @@
+-- clear the external ID of duplicate windows, keeping it on one window per external ID, preferably not deleted
+UPDATE downtime SET external_id = ''
+WHERE external_id <> '' AND id <> (
+  SELECT d.id FROM downtime d WHERE d.external_id = downtime.external_id
+  ORDER BY CASE WHEN d.deleted_at > 0 THEN 1 ELSE 0 END, d.id LIMIT 1
+);
+
+CREATE UNIQUE INDEX downtime_external_id ON downtime (external_id) WHERE external_id <> '';
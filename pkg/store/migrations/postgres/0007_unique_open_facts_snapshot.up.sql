@@ -0,0 +1,5 @@
+-- close duplicate open snapshots inserted by concurrent replicas, keeping the latest
+UPDATE cluster_facts_snapshot SET valid_to = valid_from
+WHERE valid_to = 0 AND id NOT IN (SELECT MAX(id) FROM cluster_facts_snapshot WHERE valid_to = 0 GROUP BY cluster_id);
+
+CREATE UNIQUE INDEX cluster_facts_snapshot_open ON cluster_facts_snapshot (cluster_id) WHERE valid_to = 0;
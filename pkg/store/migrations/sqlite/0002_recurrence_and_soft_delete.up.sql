@@ -0,0 +1,3 @@
+ALTER TABLE downtime ADD COLUMN "rrule" TEXT NOT NULL DEFAULT '';
+ALTER TABLE downtime ADD COLUMN "duration" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE downtime ADD COLUMN "deleted_at" INTEGER NOT NULL DEFAULT 0;
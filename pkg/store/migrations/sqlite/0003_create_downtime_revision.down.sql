@@ -0,0 +1 @@
+DROP TABLE downtime_revision;
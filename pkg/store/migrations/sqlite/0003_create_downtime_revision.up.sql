@@ -0,0 +1,23 @@
+CREATE TABLE downtime_revision (
+  "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+  "window_id" TEXT NOT NULL,
+  "action" TEXT NOT NULL,
+  "created_at" INTEGER NOT NULL,
+  "actor" TEXT NOT NULL DEFAULT '',
+  "request_id" TEXT NOT NULL DEFAULT '',
+  "internal_request_id" TEXT NOT NULL DEFAULT '',
+  "before_state" TEXT,
+  "after_state" TEXT NOT NULL
+);
+
+CREATE INDEX downtime_revision_window_id ON downtime_revision (window_id);
+
+CREATE TRIGGER downtime_revision_no_update BEFORE UPDATE ON downtime_revision
+BEGIN
+  SELECT RAISE(ABORT, 'downtime revisions are immutable');
+END;
+
+CREATE TRIGGER downtime_revision_no_delete BEFORE DELETE ON downtime_revision
+BEGIN
+  SELECT RAISE(ABORT, 'downtime revisions are immutable');
+END;
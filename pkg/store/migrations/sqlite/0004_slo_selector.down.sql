@@ -0,0 +1 @@
+ALTER TABLE downtime DROP COLUMN "slo_selector";
@@ -0,0 +1 @@
+DROP INDEX downtime_external_id;
@@ -0,0 +1 @@
+DROP INDEX cluster_facts_snapshot_open;
@@ -16,6 +16,9 @@ type MockDowntimeStore struct {
 	LastCallFrom    time.Time
 	LastCallTo      time.Time
 	LastCallCluster string
+	LastCallID      string
+	LastCallAsOf    time.Time
+	Revisions       []types.DowntimeRevision
 }
 
 func (m *MockDowntimeStore) InitializeDB() error {
@@ -24,11 +27,16 @@ func (m *MockDowntimeStore) InitializeDB() error {
 func (m *MockDowntimeStore) CloseDB() error {
 	return nil
 }
-func (m *MockDowntimeStore) StoreNewWindow(w types.DowntimeWindow) (types.DowntimeWindow, error) {
+func (m *MockDowntimeStore) StoreNewWindow(ctx context.Context, w types.DowntimeWindow) (types.DowntimeWindow, error) {
 	m.LastCall = "create"
 	if m.DoError {
 		return types.DowntimeWindow{}, errors.New("some error")
 	}
+	for _, existing := range m.ReturnValues {
+		if w.ExternalID != "" && existing.ExternalID == w.ExternalID && existing.DeletedAt != nil {
+			return types.DowntimeWindow{}, types.ErrConflict
+		}
+	}
 	return w, nil
 }
 func (m *MockDowntimeStore) ListWindows(from time.Time, to time.Time) ([]types.DowntimeWindow, error) {
@@ -50,17 +58,79 @@ func (m *MockDowntimeStore) ListWindowsMatchingClusterFacts(ctx context.Context,
 	m.LastCallCluster = clusterId
 	return slices.Clone(m.ReturnValues), nil
 }
-func (m *MockDowntimeStore) UpdateWindow(w types.DowntimeWindow) (types.DowntimeWindow, error) {
+func (m *MockDowntimeStore) UpdateWindow(ctx context.Context, w types.DowntimeWindow) (types.DowntimeWindow, error) {
 	m.LastCall = "update"
 	if m.DoError {
 		return types.DowntimeWindow{}, errors.New("some error")
 	}
 	return w, nil
 }
-func (m *MockDowntimeStore) PatchWindow(w types.DowntimeWindow) (types.DowntimeWindow, error) {
+func (m *MockDowntimeStore) PatchWindow(ctx context.Context, w types.DowntimeWindow) (types.DowntimeWindow, error) {
 	m.LastCall = "patch"
 	if m.DoError {
 		return types.DowntimeWindow{}, errors.New("some error")
 	}
 	return w, nil
 }
+func (m *MockDowntimeStore) ListWindowsIncludingDeleted(from time.Time, to time.Time) ([]types.DowntimeWindow, error) {
+	m.LastCall = "listall"
+	if m.DoError {
+		return nil, errors.New("some error")
+	}
+	m.LastCallFrom = from
+	m.LastCallTo = to
+	return slices.Clone(m.ReturnValues), nil
+}
+func (m *MockDowntimeStore) ListWindowsAsOf(from time.Time, to time.Time, asOf time.Time) ([]types.DowntimeWindow, error) {
+	m.LastCall = "listasof"
+	if m.DoError {
+		return nil, errors.New("some error")
+	}
+	m.LastCallFrom = from
+	m.LastCallTo = to
+	m.LastCallAsOf = asOf
+	return slices.Clone(m.ReturnValues), nil
+}
+func (m *MockDowntimeStore) ListWindowsMatchingClusterFactsAsOf(ctx context.Context, from time.Time, to time.Time, clusterId string, asOf time.Time) ([]types.DowntimeWindow, error) {
+	m.LastCall = "listclusterasof"
+	if m.DoError {
+		return nil, errors.New("some error")
+	}
+	m.LastCallFrom = from
+	m.LastCallTo = to
+	m.LastCallCluster = clusterId
+	m.LastCallAsOf = asOf
+	return slices.Clone(m.ReturnValues), nil
+}
+func (m *MockDowntimeStore) GetWindowHistory(id string) ([]types.DowntimeRevision, error) {
+	m.LastCall = "history"
+	m.LastCallID = id
+	if m.DoError {
+		return nil, errors.New("some error")
+	}
+	return slices.Clone(m.Revisions), nil
+}
+func (m *MockDowntimeStore) GetWindow(id string) (types.DowntimeWindow, error) {
+	m.LastCall = "get"
+	return m.findWindow(id)
+}
+func (m *MockDowntimeStore) DeleteWindow(ctx context.Context, id string) (types.DowntimeWindow, error) {
+	m.LastCall = "delete"
+	return m.findWindow(id)
+}
+func (m *MockDowntimeStore) RestoreWindow(ctx context.Context, id string) (types.DowntimeWindow, error) {
+	m.LastCall = "restore"
+	return m.findWindow(id)
+}
+func (m *MockDowntimeStore) findWindow(id string) (types.DowntimeWindow, error) {
+	m.LastCallID = id
+	if m.DoError {
+		return types.DowntimeWindow{}, errors.New("some error")
+	}
+	if len(m.ReturnValues) == 0 {
+		return types.DowntimeWindow{}, types.ErrNotFound
+	}
+	w := m.ReturnValues[0]
+	w.ID = id
+	return w, nil
+}
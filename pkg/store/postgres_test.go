@@ -0,0 +1,47 @@
+//go:build integration
+
+package store
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostgresConformance runs the conformance suite against the PostgreSQL database in POSTGRES_TEST_URL.
+// Every store gets its own schema, which is dropped after the test.
+func TestPostgresConformance(t *testing.T) {
+	dburl := os.Getenv("POSTGRES_TEST_URL")
+	if dburl == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+	admin, err := sqlx.Open("pgx", dburl)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	runConformanceSuite(t, func(t *testing.T, lieutenant Client) *downtimeStore {
+		schema := fmt.Sprintf("conformance_%d", rand.Uint32())
+		_, err := admin.Exec("CREATE SCHEMA " + schema)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+			require.NoError(t, err)
+		})
+
+		u, err := url.Parse(dburl)
+		require.NoError(t, err)
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+
+		store, err := NewPostgresDowntimeStore(u.String(), lieutenant)
+		require.NoError(t, err)
+		t.Cleanup(func() { store.CloseDB() })
+		return store
+	})
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/vshn/vshn-sli-reporting/pkg/audit"
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+const (
+	actionCreate  = "create"
+	actionUpdate  = "update"
+	actionPatch   = "patch"
+	actionDelete  = "delete"
+	actionRestore = "restore"
+)
+
+type dbDowntimeRevision struct {
+	ID                int64          `db:"id"`
+	WindowID          string         `db:"window_id"`
+	Action            string         `db:"action"`
+	CreatedAt         int64          `db:"created_at"`
+	Actor             string         `db:"actor"`
+	RequestID         string         `db:"request_id"`
+	InternalRequestID string         `db:"internal_request_id"`
+	BeforeState       sql.NullString `db:"before_state"`
+	AfterState        string         `db:"after_state"`
+}
+
+// commitRevision records the change from `before` to `after` as revision and commits the transaction.
+// `before` is nil for newly created windows.
+func (s *downtimeStore) commitRevision(ctx context.Context, tx *sqlx.Tx, action string, before *dbDowntimeWindow, after dbDowntimeWindow) (types.DowntimeWindow, error) {
+	rv, err := convertFromDbStruct(after)
+	if err != nil {
+		return types.DowntimeWindow{}, fmt.Errorf("unable to convert store result: %w", err)
+	}
+	afterState, err := json.Marshal(rv)
+	if err != nil {
+		return types.DowntimeWindow{}, fmt.Errorf("unable to serialize revision: %w", err)
+	}
+
+	actor := audit.FromContext(ctx)
+	rev := dbDowntimeRevision{
+		WindowID:          after.ID,
+		Action:            action,
+		CreatedAt:         s.now().Unix(),
+		Actor:             actor.User,
+		RequestID:         actor.RequestID,
+		InternalRequestID: actor.InternalRequestID,
+		AfterState:        string(afterState),
+	}
+	if before != nil {
+		b, err := convertFromDbStruct(*before)
+		if err != nil {
+			return types.DowntimeWindow{}, fmt.Errorf("unable to convert previous state: %w", err)
+		}
+		beforeState, err := json.Marshal(b)
+		if err != nil {
+			return types.DowntimeWindow{}, fmt.Errorf("unable to serialize revision: %w", err)
+		}
+		rev.BeforeState = sql.NullString{String: string(beforeState), Valid: true}
+	}
+
+	q := `INSERT INTO downtime_revision (window_id, action, created_at, actor, request_id, internal_request_id, before_state, after_state) VALUES (:window_id, :action, :created_at, :actor, :request_id, :internal_request_id, :before_state, :after_state)`
+	_, err = tx.NamedExec(q, rev)
+	if err != nil {
+		return types.DowntimeWindow{}, fmt.Errorf("unable to store revision: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.DowntimeWindow{}, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return rv, nil
+}
+
+// GetWindowHistory returns all revisions of the window, oldest first
+func (s *downtimeStore) GetWindowHistory(id string) ([]types.DowntimeRevision, error) {
+	_, err := getWindowById(s.db, id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get downtime window: %w", err)
+	}
+
+	results := []dbDowntimeRevision{}
+	err = s.db.Select(&results, s.db.Rebind("SELECT * FROM downtime_revision WHERE window_id = ? ORDER BY id"), id)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying revisions: %w", err)
+	}
+
+	revisions := make([]types.DowntimeRevision, len(results))
+	for i, r := range results {
+		rev, err := convertFromDbRevision(r)
+		if err != nil {
+			return nil, fmt.Errorf("error while converting revision list: %w", err)
+		}
+		revisions[i] = rev
+	}
+	return revisions, nil
+}
+
+// ListWindowsAsOf works like ListWindows, but returns the downtime windows as they were at `asOf`.
+// Windows without any recorded revision are assumed to be unchanged since before the history was recorded.
+func (s *downtimeStore) ListWindowsAsOf(from time.Time, to time.Time, asOf time.Time) ([]types.DowntimeWindow, error) {
+	fromUnix, toUnix, asOfUnix := from.Unix(), to.Unix(), asOf.Unix()
+
+	results := []dbDowntimeWindow{}
+	q := `SELECT * FROM downtime WHERE (end_time > ? OR end_time <= 0) AND start_time < ? AND deleted_at <= 0
+	  AND NOT EXISTS (SELECT 1 FROM downtime_revision WHERE downtime_revision.window_id = downtime.id)`
+	err := s.db.Select(&results, s.db.Rebind(q), fromUnix, toUnix)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying downtime windows: %w", err)
+	}
+
+	// For each window, the latest revision at `asOf` holds its state.
+	// Windows that were only changed after `asOf` were in the state before their first change.
+	revisions := []dbDowntimeRevision{}
+	q = `SELECT * FROM downtime_revision WHERE id IN (
+	  SELECT MAX(id) FROM downtime_revision WHERE created_at <= ? GROUP BY window_id
+	  UNION
+	  SELECT MIN(id) FROM downtime_revision GROUP BY window_id HAVING MIN(created_at) > ?
+	)`
+	err = s.db.Select(&revisions, s.db.Rebind(q), asOfUnix, asOfUnix)
+	if err != nil {
+		return nil, fmt.Errorf("error while querying revisions: %w", err)
+	}
+
+	for _, r := range revisions {
+		state := r.AfterState
+		if r.CreatedAt > asOfUnix {
+			if !r.BeforeState.Valid {
+				// the window did not exist yet
+				continue
+			}
+			state = r.BeforeState.String
+		}
+		c, err := convertFromRevisionState(state)
+		if err != nil {
+			return nil, fmt.Errorf("error while converting revision of %q: %w", r.WindowID, err)
+		}
+		if c.DeletedAt <= 0 && (c.EndTime > fromUnix || c.EndTime <= 0) && c.StartTime < toUnix {
+			results = append(results, c)
+		}
+	}
+
+	return expandWindows(results, from, to)
+}
+
+func convertFromRevisionState(state string) (dbDowntimeWindow, error) {
+	w := types.DowntimeWindow{}
+	if err := json.Unmarshal([]byte(state), &w); err != nil {
+		return dbDowntimeWindow{}, fmt.Errorf("could not parse revision: %w", err)
+	}
+	st, err := convertToDbStruct(w)
+	if err != nil {
+		return dbDowntimeWindow{}, err
+	}
+	if w.DeletedAt != nil {
+		st.DeletedAt = w.DeletedAt.Unix()
+	}
+	return st, nil
+}
+
+func convertFromDbRevision(r dbDowntimeRevision) (types.DowntimeRevision, error) {
+	rev := types.DowntimeRevision{
+		ID:                r.ID,
+		WindowID:          r.WindowID,
+		Action:            r.Action,
+		Time:              time.Unix(r.CreatedAt, 0).UTC(),
+		User:              r.Actor,
+		RequestID:         r.RequestID,
+		InternalRequestID: r.InternalRequestID,
+	}
+	if err := json.Unmarshal([]byte(r.AfterState), &rev.After); err != nil {
+		return types.DowntimeRevision{}, fmt.Errorf("could not parse revision: %w", err)
+	}
+	if r.BeforeState.Valid {
+		rev.Before = &types.DowntimeWindow{}
+		if err := json.Unmarshal([]byte(r.BeforeState.String), rev.Before); err != nil {
+			return types.DowntimeRevision{}, fmt.Errorf("could not parse revision: %w", err)
+		}
+	}
+	return rev, nil
+}
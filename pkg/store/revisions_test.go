@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vshn/vshn-sli-reporting/pkg/audit"
+	"github.com/vshn/vshn-sli-reporting/pkg/types"
+)
+
+func setClock(store *downtimeStore, ts string) {
+	t, _ := time.Parse(time.RFC3339, ts)
+	store.now = func() time.Time { return t }
+}
+
+func TestWindowHistory(t *testing.T) {
+	store := setup(t)
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
+	require.NoError(t, store.InitializeDB())
+
+	ctx := audit.NewContext(context.TODO(), audit.Actor{User: "admin", RequestID: "req-1", InternalRequestID: "int-1"})
+	w, err := store.StoreNewWindow(ctx, types.DowntimeWindow{
+		StartTime: &time1,
+		Title:     "Test1",
+		Affects:   []types.AffectedClusterMatcher{},
+	})
+	require.NoError(t, err)
+	_, err = store.PatchWindow(context.TODO(), types.DowntimeWindow{ID: w.ID, EndTime: &time2})
+	require.NoError(t, err)
+	_, err = store.DeleteWindow(context.TODO(), w.ID)
+	require.NoError(t, err)
+	_, err = store.RestoreWindow(context.TODO(), w.ID)
+	require.NoError(t, err)
+
+	revs, err := store.GetWindowHistory(w.ID)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(revs))
+
+	assert.Equal(t, "create", revs[0].Action)
+	assert.Equal(t, "admin", revs[0].User)
+	assert.Equal(t, "req-1", revs[0].RequestID)
+	assert.Equal(t, "int-1", revs[0].InternalRequestID)
+	assert.Nil(t, revs[0].Before)
+	assert.Equal(t, w, revs[0].After)
+
+	assert.Equal(t, "patch", revs[1].Action)
+	assert.Equal(t, w, *revs[1].Before)
+	assert.True(t, time2.Equal(*revs[1].After.EndTime))
+
+	assert.Equal(t, "delete", revs[2].Action)
+	assert.Nil(t, revs[2].Before.DeletedAt)
+	assert.NotNil(t, revs[2].After.DeletedAt)
+
+	assert.Equal(t, "restore", revs[3].Action)
+	assert.Nil(t, revs[3].After.DeletedAt)
+
+	_, err = store.GetWindowHistory("nope")
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
+
+func TestRevisionsAreImmutable(t *testing.T) {
+	store := setup(t)
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	require.NoError(t, store.InitializeDB())
+	_, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime: &time1,
+		Title:     "Test1",
+		Affects:   []types.AffectedClusterMatcher{},
+	})
+	require.NoError(t, err)
+
+	_, err = store.db.Exec("UPDATE downtime_revision SET actor = 'someone'")
+	assert.Error(t, err)
+	_, err = store.db.Exec("DELETE FROM downtime_revision")
+	assert.Error(t, err)
+}
+
+func TestListWindowsAsOf(t *testing.T) {
+	time1, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	time2, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
+	time3, _ := time.Parse(time.RFC3339, "2020-01-03T00:00:00Z")
+	store := setupAndSeed(t, map[string]string{"foo": "bar"})
+
+	setClock(store, "2020-02-01T00:00:00Z")
+	w, err := store.StoreNewWindow(context.TODO(), types.DowntimeWindow{
+		StartTime: &time1,
+		EndTime:   &time2,
+		Title:     "Audited",
+		Affects:   []types.AffectedClusterMatcher{{"foo": {Value: "bar"}}},
+	})
+	require.NoError(t, err)
+
+	setClock(store, "2020-02-02T00:00:00Z")
+	_, err = store.PatchWindow(context.TODO(), types.DowntimeWindow{ID: w.ID, Title: "Audited2", EndTime: &time3})
+	require.NoError(t, err)
+
+	setClock(store, "2020-02-03T00:00:00Z")
+	_, err = store.DeleteWindow(context.TODO(), w.ID)
+	require.NoError(t, err)
+
+	from, _ := time.Parse(time.RFC3339, "2020-01-02T12:00:00Z")
+	to, _ := time.Parse(time.RFC3339, "2020-01-04T12:00:00Z")
+
+	titlesAsOf := func(asOf string) []string {
+		t.Helper()
+		at, _ := time.Parse(time.RFC3339, asOf)
+		windows, err := store.ListWindowsMatchingClusterFactsAsOf(context.TODO(), from, to, "unused", at)
+		require.NoError(t, err)
+		titles := []string{}
+		for _, w := range windows {
+			titles = append(titles, w.Title)
+		}
+		return titles
+	}
+
+	// the seeded windows are created at the current time
+	assert.ElementsMatch(t, []string{}, titlesAsOf("2020-01-15T00:00:00Z"))
+	// the window ends before `from`
+	assert.ElementsMatch(t, []string{}, titlesAsOf("2020-02-01T12:00:00Z"))
+	assert.ElementsMatch(t, []string{"Audited2"}, titlesAsOf("2020-02-02T12:00:00Z"))
+	assert.ElementsMatch(t, []string{}, titlesAsOf("2020-02-03T12:00:00Z"))
+	assert.ElementsMatch(t, []string{"Test2", "Test3"}, titlesAsOf(time.Now().Add(time.Minute).Format(time.RFC3339)))
+}
+
+func TestListWindowsAsOfWithoutRevisions(t *testing.T) {
+	store := setup(t)
+	require.NoError(t, store.InitializeDB())
+	// windows created before revisions were recorded
+	_, err := store.db.Exec(`INSERT INTO downtime (id, start_time, end_time, title, description, external_id, external_link, affects) VALUES ('old', 1577836800, 1577923200, 'Old', '', '', '', '[]')`)
+	require.NoError(t, err)
+
+	from, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	to, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00Z")
+	windows, err := store.ListWindowsAsOf(from, to, from)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(windows))
+	assert.Equal(t, "Old", windows[0].Title)
+}
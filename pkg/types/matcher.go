@@ -0,0 +1,232 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// AffectedClusterMatcher matches a cluster if all of its fact matchers match the cluster's match context, see Cluster.MatchContext.
+// The map is keyed by fact name or by one of the reserved keys, e.g. `{"cluster:tenant": "t-acme", "label:env": "prod"}`.
+type AffectedClusterMatcher = map[string]FactMatcher
+
+// Reserved keys of the cluster match context
+const (
+	// MatchKeyClusterID is the Lieutenant cluster ID
+	MatchKeyClusterID = "cluster:id"
+	// MatchKeyTenant is the ID of the Lieutenant tenant of the cluster
+	MatchKeyTenant = "cluster:tenant"
+	// MatchKeyDisplayName is the display name of the cluster
+	MatchKeyDisplayName = "cluster:display_name"
+	// MatchKeyLabelPrefix prefixes the metadata labels of the Lieutenant cluster object
+	MatchKeyLabelPrefix = "label:"
+	// MatchKeyAnnotationPrefix prefixes the metadata annotations of the Lieutenant cluster object
+	MatchKeyAnnotationPrefix = "annotation:"
+	// MatchKeyDynamicFactPrefix prefixes the dynamic facts reported by the cluster
+	MatchKeyDynamicFactPrefix = "dynamic_fact:"
+
+	matchKeyClusterPrefix = "cluster:"
+)
+
+type MatchOperator string
+
+const (
+	MatchEqual     MatchOperator = "="
+	MatchNotEqual  MatchOperator = "!="
+	MatchRegexp    MatchOperator = "=~"
+	MatchNotRegexp MatchOperator = "!~"
+	MatchExists    MatchOperator = "exists"
+	MatchNotExists MatchOperator = "not-exists"
+	MatchIn        MatchOperator = "in"
+	MatchNotIn     MatchOperator = "not-in"
+)
+
+// FactMatcher matches the value of a single cluster fact, modeled on Prometheus label matchers.
+//
+// In JSON, a plain string is an equality matcher, which keeps the original `{"fact": "value"}` form valid.
+// All other operators use the object form, e.g. `{"op": "=~", "value": "openshift4|oke"}` or `{"op": "in", "values": ["a", "b"]}`.
+//
+// Like in Prometheus, regular expressions are fully anchored and a missing fact is treated as an empty value by
+// `!=`, `=~` and `!~`. `=` and `in` only match facts that exist.
+type FactMatcher struct {
+	// Op is the match operator. An empty operator is an equality matcher.
+	Op     MatchOperator `json:"op,omitempty"`
+	Value  string        `json:"value,omitempty"`
+	Values []string      `json:"values,omitempty"`
+
+	// re caches the compiled regular expression of `=~` and `!~` matchers, it is set when unmarshalling
+	re *regexp.Regexp
+}
+
+func (m FactMatcher) MarshalJSON() ([]byte, error) {
+	if (m.Op == "" || m.Op == MatchEqual) && len(m.Values) == 0 {
+		return json.Marshal(m.Value)
+	}
+	type plain FactMatcher
+	return json.Marshal(plain(m))
+}
+
+func (m *FactMatcher) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*m = FactMatcher{Value: value}
+		return nil
+	}
+	type plain FactMatcher
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("fact matcher must be a string or an object: %w", err)
+	}
+	*m = FactMatcher(p)
+	if m.Op == MatchRegexp || m.Op == MatchNotRegexp {
+		// invalid expressions are reported by Validate
+		m.re, _ = compileAnchored(m.Value)
+	}
+	return nil
+}
+
+// Validate returns an error if the operator is unknown, the operands do not fit the operator or a regular expression does not compile
+func (m FactMatcher) Validate() error {
+	switch m.Op {
+	case "", MatchEqual, MatchNotEqual:
+		if len(m.Values) > 0 {
+			return fmt.Errorf("operator %q does not accept values", m.Op)
+		}
+	case MatchRegexp, MatchNotRegexp:
+		if len(m.Values) > 0 {
+			return fmt.Errorf("operator %q does not accept values", m.Op)
+		}
+		if _, err := compileAnchored(m.Value); err != nil {
+			return fmt.Errorf("invalid regular expression %q: %w", m.Value, err)
+		}
+	case MatchExists, MatchNotExists:
+		if m.Value != "" || len(m.Values) > 0 {
+			return fmt.Errorf("operator %q does not accept a value", m.Op)
+		}
+	case MatchIn, MatchNotIn:
+		if m.Value != "" {
+			return fmt.Errorf("operator %q expects values instead of value", m.Op)
+		}
+		if len(m.Values) == 0 {
+			return fmt.Errorf("operator %q requires at least one value", m.Op)
+		}
+	default:
+		return fmt.Errorf("unknown match operator %q", m.Op)
+	}
+	return nil
+}
+
+// Matches returns true if the fact `value` satisfies the matcher. `exists` is false if the cluster does not have the fact.
+// Invalid matchers never match.
+func (m FactMatcher) Matches(value string, exists bool) bool {
+	switch m.Op {
+	case "", MatchEqual:
+		return exists && value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp, MatchNotRegexp:
+		re := m.re
+		if re == nil {
+			var err error
+			if re, err = compileAnchored(m.Value); err != nil {
+				return false
+			}
+		}
+		return re.MatchString(value) == (m.Op == MatchRegexp)
+	case MatchExists:
+		return exists
+	case MatchNotExists:
+		return !exists
+	case MatchIn:
+		return exists && slices.Contains(m.Values, value)
+	case MatchNotIn:
+		return !exists || !slices.Contains(m.Values, value)
+	}
+	return false
+}
+
+// SLOSelector restricts a downtime window to the SLOs whose labels match all of its matchers.
+// The map is keyed by one of the SLOSelectorLabels.
+type SLOSelector map[string]FactMatcher
+
+// SLOSelectorLabels are the Sloth labels an SLOSelector can match on
+var SLOSelectorLabels = []string{"sloth_id", "sloth_service", "sloth_slo"}
+
+// Validate returns an error if the selector uses unsupported labels or invalid matchers
+func (s SLOSelector) Validate() error {
+	errs := []error{}
+	for _, l := range slices.Sorted(maps.Keys(s)) {
+		if !slices.Contains(SLOSelectorLabels, l) {
+			errs = append(errs, fmt.Errorf("slo_selector[%q]: unsupported label, expected one of %v", l, SLOSelectorLabels))
+			continue
+		}
+		if err := s[l].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("slo_selector[%q]: %w", l, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Matches returns true if the SLO with the given labels is selected. An empty selector selects all SLOs.
+func (s SLOSelector) Matches(labels map[string]string) bool {
+	return MatchesAll(s, labels)
+}
+
+// MatchesAll returns true if all matchers match the given values
+func MatchesAll(matchers map[string]FactMatcher, values map[string]string) bool {
+	for k, m := range matchers {
+		v, ok := values[k]
+		if !m.Matches(v, ok) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesAny returns true if any of the cluster matchers matches the given facts
+func MatchesAny(affects []AffectedClusterMatcher, facts map[string]string) bool {
+	for _, a := range affects {
+		if MatchesAll(a, facts) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAffects validates all fact matchers of the given cluster matchers
+func ValidateAffects(affects []AffectedClusterMatcher) error {
+	errs := []error{}
+	for i, a := range affects {
+		for _, fact := range slices.Sorted(maps.Keys(a)) {
+			if err := validateMatchKey(fact); err != nil {
+				errs = append(errs, fmt.Errorf("affects[%d][%q]: %w", i, fact, err))
+			}
+			if err := a[fact].Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("affects[%d][%q]: %w", i, fact, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateMatchKey rejects unknown reserved keys and reserved prefixes without name
+func validateMatchKey(key string) error {
+	switch key {
+	case MatchKeyClusterID, MatchKeyTenant, MatchKeyDisplayName:
+		return nil
+	case MatchKeyLabelPrefix, MatchKeyAnnotationPrefix, MatchKeyDynamicFactPrefix:
+		return fmt.Errorf("missing name after reserved prefix %q", key)
+	}
+	if strings.HasPrefix(key, matchKeyClusterPrefix) {
+		return fmt.Errorf("unknown reserved key, expected one of %q, %q or %q", MatchKeyClusterID, MatchKeyTenant, MatchKeyDisplayName)
+	}
+	return nil
+}
+
+func compileAnchored(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
@@ -0,0 +1,163 @@
+package types
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFactMatcherJSON(t *testing.T) {
+	affects := []AffectedClusterMatcher{}
+	err := json.Unmarshal([]byte(`[
+		{"cloud": "cloudscale"},
+		{"distribution": {"op": "=~", "value": "openshift4|oke"}, "tenant": {"op": "!=", "value": "t-x"}},
+		{"region": {"op": "in", "values": ["lpg", "rma"]}, "maintenance": {"op": "not-exists"}}
+	]`), &affects)
+	require.NoError(t, err)
+	assert.Equal(t, []AffectedClusterMatcher{
+		{"cloud": {Value: "cloudscale"}},
+		{"distribution": {Op: MatchRegexp, Value: "openshift4|oke", re: regexp.MustCompile("^(?:openshift4|oke)$")}, "tenant": {Op: MatchNotEqual, Value: "t-x"}},
+		{"region": {Op: MatchIn, Values: []string{"lpg", "rma"}}, "maintenance": {Op: MatchNotExists}},
+	}, affects, "regular expressions are compiled when unmarshalling")
+
+	out, err := json.Marshal(affects)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"cloud": "cloudscale"},
+		{"distribution": {"op": "=~", "value": "openshift4|oke"}, "tenant": {"op": "!=", "value": "t-x"}},
+		{"region": {"op": "in", "values": ["lpg", "rma"]}, "maintenance": {"op": "not-exists"}}
+	]`, string(out))
+
+	err = json.Unmarshal([]byte(`[{"cloud": 42}]`), &affects)
+	assert.Error(t, err)
+}
+
+func TestFactMatcherValidate(t *testing.T) {
+	valid := []FactMatcher{
+		{Value: "a"},
+		{Op: MatchEqual, Value: ""},
+		{Op: MatchNotEqual, Value: "a"},
+		{Op: MatchRegexp, Value: "a|b.*"},
+		{Op: MatchNotRegexp, Value: ""},
+		{Op: MatchExists},
+		{Op: MatchNotExists},
+		{Op: MatchIn, Values: []string{"a"}},
+		{Op: MatchNotIn, Values: []string{"a", "b"}},
+	}
+	for _, m := range valid {
+		assert.NoError(t, m.Validate(), m)
+	}
+
+	invalid := []FactMatcher{
+		{Op: "~", Value: "a"},
+		{Op: MatchEqual, Values: []string{"a"}},
+		{Op: MatchRegexp, Value: "a("},
+		{Op: MatchNotRegexp, Value: "[a"},
+		{Op: MatchExists, Value: "a"},
+		{Op: MatchIn},
+		{Op: MatchNotIn, Value: "a"},
+	}
+	for _, m := range invalid {
+		assert.Error(t, m.Validate(), m)
+	}
+
+	err := ValidateAffects([]AffectedClusterMatcher{
+		{"a": {Value: "x"}},
+		{"b": {Op: MatchRegexp, Value: "("}},
+	})
+	assert.ErrorContains(t, err, `affects[1]["b"]`)
+}
+
+func TestFactMatcherMatches(t *testing.T) {
+	tcs := []struct {
+		m       FactMatcher
+		value   string
+		exists  bool
+		matches bool
+	}{
+		{FactMatcher{Value: "a"}, "a", true, true},
+		{FactMatcher{Value: "a"}, "b", true, false},
+		{FactMatcher{Value: ""}, "", false, false},
+		{FactMatcher{Op: MatchNotEqual, Value: "a"}, "b", true, true},
+		{FactMatcher{Op: MatchNotEqual, Value: "a"}, "a", true, false},
+		{FactMatcher{Op: MatchNotEqual, Value: "a"}, "", false, true},
+		{FactMatcher{Op: MatchRegexp, Value: "openshift4|oke"}, "oke", true, true},
+		{FactMatcher{Op: MatchRegexp, Value: "openshift4|oke"}, "openshift4", true, true},
+		{FactMatcher{Op: MatchRegexp, Value: "openshift"}, "openshift4", true, false},
+		{FactMatcher{Op: MatchRegexp, Value: ".*"}, "", false, true},
+		{FactMatcher{Op: MatchNotRegexp, Value: "t-.*"}, "t-x", true, false},
+		{FactMatcher{Op: MatchNotRegexp, Value: "t-.*"}, "other", true, true},
+		{FactMatcher{Op: MatchNotRegexp, Value: "("}, "other", true, false},
+		{FactMatcher{Op: MatchExists}, "", true, true},
+		{FactMatcher{Op: MatchExists}, "", false, false},
+		{FactMatcher{Op: MatchNotExists}, "", false, true},
+		{FactMatcher{Op: MatchNotExists}, "a", true, false},
+		{FactMatcher{Op: MatchIn, Values: []string{"a", "b"}}, "b", true, true},
+		{FactMatcher{Op: MatchIn, Values: []string{"a", "b"}}, "c", true, false},
+		{FactMatcher{Op: MatchIn, Values: []string{""}}, "", false, false},
+		{FactMatcher{Op: MatchNotIn, Values: []string{"a", "b"}}, "c", true, true},
+		{FactMatcher{Op: MatchNotIn, Values: []string{"a", "b"}}, "a", true, false},
+		{FactMatcher{Op: MatchNotIn, Values: []string{"a", "b"}}, "", false, true},
+		{FactMatcher{Op: "unknown"}, "a", true, false},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.matches, tc.m.Matches(tc.value, tc.exists), "%+v matching %q (exists: %t)", tc.m, tc.value, tc.exists)
+	}
+}
+
+func TestSLOSelector(t *testing.T) {
+	sel := SLOSelector{
+		"sloth_service": {Op: MatchRegexp, Value: "postgres|mysql"},
+		"sloth_slo":     {Op: MatchNotEqual, Value: "latency"},
+	}
+	assert.NoError(t, sel.Validate())
+	assert.True(t, sel.Matches(map[string]string{"sloth_id": "postgres-requests", "sloth_service": "postgres", "sloth_slo": "requests"}))
+	assert.False(t, sel.Matches(map[string]string{"sloth_id": "postgres-latency", "sloth_service": "postgres", "sloth_slo": "latency"}))
+	assert.False(t, sel.Matches(map[string]string{"sloth_id": "ingress", "sloth_service": "ingress", "sloth_slo": "requests"}))
+	assert.True(t, SLOSelector{}.Matches(map[string]string{"sloth_id": "ingress"}))
+
+	assert.ErrorContains(t, SLOSelector{"cluster_id": {Value: "c-a"}}.Validate(), "unsupported label")
+	assert.ErrorContains(t, SLOSelector{"sloth_id": {Op: MatchRegexp, Value: "("}}.Validate(), "invalid regular expression")
+}
+
+func TestClusterMatchContext(t *testing.T) {
+	c := Cluster{
+		ID:           "c-one",
+		DisplayName:  "One",
+		Tenant:       "t-acme",
+		Labels:       map[string]string{"env": "prod"},
+		Annotations:  map[string]string{"example.com/owner": "team-a"},
+		Facts:        map[string]string{"cloud": "cloudscale", "cluster:id": "spoofed"},
+		DynamicFacts: map[string]string{"kubernetesVersion": "1.33"},
+	}
+	assert.Equal(t, map[string]string{
+		"cloud":                          "cloudscale",
+		"cluster:id":                     "c-one",
+		"cluster:tenant":                 "t-acme",
+		"cluster:display_name":           "One",
+		"label:env":                      "prod",
+		"annotation:example.com/owner":   "team-a",
+		"dynamic_fact:kubernetesVersion": "1.33",
+	}, c.MatchContext())
+
+	assert.True(t, MatchesAny([]AffectedClusterMatcher{
+		{"cluster:tenant": {Value: "t-other"}},
+		{"cluster:tenant": {Value: "t-acme"}, "label:env": {Op: MatchIn, Values: []string{"prod", "staging"}}},
+	}, c.MatchContext()))
+	assert.False(t, MatchesAny([]AffectedClusterMatcher{
+		{"cluster:id": {Value: "c-two"}},
+		{"cloud": {Value: "cloudscale"}, "annotation:example.com/owner": {Value: "team-b"}},
+	}, c.MatchContext()))
+}
+
+func TestValidateAffectsReservedKeys(t *testing.T) {
+	assert.NoError(t, ValidateAffects([]AffectedClusterMatcher{
+		{"cluster:id": {Value: "c-one"}, "cluster:tenant": {Value: "t-acme"}, "cluster:display_name": {Op: MatchRegexp, Value: "One.*"}},
+		{"label:env": {Value: "prod"}, "annotation:owner": {Op: MatchExists}, "dynamic_fact:kubernetesVersion": {Value: "1.33"}, "cloud": {Value: "cloudscale"}},
+	}))
+	assert.ErrorContains(t, ValidateAffects([]AffectedClusterMatcher{{"cluster:name": {Value: "c-one"}}}), "unknown reserved key")
+	assert.ErrorContains(t, ValidateAffects([]AffectedClusterMatcher{{"label:": {Value: "prod"}}}), "missing name")
+}
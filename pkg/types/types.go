@@ -1,6 +1,15 @@
 package types
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by stores if a requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned by stores if a record conflicts with an existing one
+var ErrConflict = errors.New("conflict")
 
 type DowntimeWindow struct {
 	ID           string                   `json:"id"`
@@ -11,6 +20,80 @@ type DowntimeWindow struct {
 	ExternalID   string                   `json:"external_id,omitempty"`
 	ExternalLink string                   `json:"external_link,omitempty"`
 	Affects      []AffectedClusterMatcher `json:"affects"`
+	// SLOSelector limits the window to matching SLOs on the affected clusters. If empty, the window applies to all SLOs.
+	SLOSelector SLOSelector `json:"slo_selector,omitempty"`
+	// Recurrence makes the window repeat. StartTime is the start of the first occurrence.
+	// Listing windows expands the occurrences, each with its own StartTime and EndTime.
+	// The occurrences share the ID of the window, so ID and StartTime identify an occurrence.
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	// DeletedAt is set if the window has been soft-deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type Recurrence struct {
+	// Rule is an RFC 5545 recurrence rule, e.g. "FREQ=WEEKLY;BYDAY=TU;BYHOUR=22".
+	// Supported parts are FREQ, INTERVAL, BYDAY, BYHOUR, UNTIL and COUNT.
+	Rule string `json:"rule"`
+	// Duration is the length of each occurrence, e.g. "4h".
+	Duration string `json:"duration"`
+}
+
+type DowntimeRevision struct {
+	ID       int64     `json:"id"`
+	WindowID string    `json:"window_id"`
+	Action   string    `json:"action"`
+	Time     time.Time `json:"time"`
+	// User is the authenticated API user who made the change.
+	User              string `json:"user,omitempty"`
+	RequestID         string `json:"request_id,omitempty"`
+	InternalRequestID string `json:"internal_request_id,omitempty"`
+	// Before is the state of the window before the change. It is empty for newly created windows.
+	Before *DowntimeWindow `json:"before,omitempty"`
+	After  DowntimeWindow  `json:"after"`
 }
 
-type AffectedClusterMatcher = map[string]string
+// Cluster is the metadata of a Lieutenant cluster
+type Cluster struct {
+	ID          string            `json:"id"`
+	DisplayName string            `json:"display_name"`
+	Tenant      string            `json:"tenant"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Facts are the statically configured facts of the cluster
+	Facts map[string]string `json:"facts,omitempty"`
+	// DynamicFacts are the facts reported by the cluster
+	DynamicFacts map[string]string `json:"dynamic_facts,omitempty"`
+}
+
+// MatchContext returns the values downtime windows are matched against.
+// It contains the static facts by name and the metadata of the cluster under the reserved keys, see MatchKeyClusterID.
+// Reserved keys take precedence over facts with the same name.
+func (c Cluster) MatchContext() map[string]string {
+	mc := make(map[string]string, len(c.Facts)+len(c.DynamicFacts)+len(c.Labels)+len(c.Annotations)+3)
+	for k, v := range c.Facts {
+		mc[k] = v
+	}
+	for k, v := range c.DynamicFacts {
+		mc[MatchKeyDynamicFactPrefix+k] = v
+	}
+	for k, v := range c.Labels {
+		mc[MatchKeyLabelPrefix+k] = v
+	}
+	for k, v := range c.Annotations {
+		mc[MatchKeyAnnotationPrefix+k] = v
+	}
+	mc[MatchKeyClusterID] = c.ID
+	mc[MatchKeyTenant] = c.Tenant
+	mc[MatchKeyDisplayName] = c.DisplayName
+	return mc
+}
+
+// ClusterFactsSnapshot are the facts of a cluster during a time interval
+type ClusterFactsSnapshot struct {
+	ClusterID string `json:"cluster_id"`
+	// Facts is the match context of the cluster without annotations and dynamic facts, see Cluster.MatchContext
+	Facts     map[string]string `json:"facts"`
+	ValidFrom time.Time         `json:"valid_from"`
+	// ValidTo is nil for the current facts
+	ValidTo *time.Time `json:"valid_to,omitempty"`
+}